@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 )
 
 func (cli *Client) CreateHeritage(districtName string, h *Heritage) (*Heritage, error) {
@@ -25,24 +27,42 @@ func (cli *Client) CreateHeritage(districtName string, h *Heritage) (*Heritage,
 	return hResp.Heritage, nil
 }
 
+func (cli *Client) ShowHeritage(name string) (*Heritage, error) {
+	resp, err := cli.Get("/heritages/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var hResp HeritageResponse
+	err = json.Unmarshal(resp, &hResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return hResp.Heritage, nil
+}
+
 func (h *Heritage) Print() {
-	fmt.Printf("Name:          %s\n", h.Name)
-	fmt.Printf("Image Name:    %s\n", h.ImageName)
-	fmt.Printf("Image Tag :    %s\n", h.ImageTag)
-	fmt.Printf("Version:       %d\n", h.Version)
+	h.Fprint(os.Stdout)
+}
+
+func (h *Heritage) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "Name:          %s\n", h.Name)
+	fmt.Fprintf(w, "Image Name:    %s\n", h.ImageName)
+	fmt.Fprintf(w, "Image Tag :    %s\n", h.ImageTag)
+	fmt.Fprintf(w, "Version:       %d\n", h.Version)
 	if h.BeforeDeploy != nil {
-		fmt.Printf("Before Deploy: %s\n", *h.BeforeDeploy)
+		fmt.Fprintf(w, "Before Deploy: %s\n", *h.BeforeDeploy)
 	} else {
-		fmt.Printf("Before Deploy: None\n")
+		fmt.Fprintf(w, "Before Deploy: None\n")
 	}
-	fmt.Printf("Token:         %s\n", h.Token)
-	fmt.Printf("Scheduled Tasks:\n")
+	fmt.Fprintf(w, "Token:         %s\n", h.Token)
+	fmt.Fprintf(w, "Scheduled Tasks:\n")
 	for _, task := range h.ScheduledTasks {
-		fmt.Printf("%-20s %s\n", task.Schedule, task.Command)
+		fmt.Fprintf(w, "%-20s %s\n", task.Schedule, task.Command)
 	}
 
-	fmt.Printf("Environment Variables\n")
+	fmt.Fprintf(w, "Environment Variables\n")
 	for name, value := range h.EnvVars {
-		fmt.Printf("  %s: %s\n", name, value)
+		fmt.Fprintf(w, "  %s: %s\n", name, value)
 	}
 }
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"fmt"
+	"io"
+)
+
+func (o *Oneoff) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "ID:        %d\n", o.ID)
+	fmt.Fprintf(w, "Status:    %s\n", o.Status)
+	fmt.Fprintf(w, "Command:   %s\n", o.Command)
+	if len(o.ExitCode) > 0 {
+		fmt.Fprintf(w, "Exit Code: %s\n", o.ExitCode)
+	}
+	if len(o.Reason) > 0 {
+		fmt.Fprintf(w, "Reason:    %s\n", o.Reason)
+	}
+	fmt.Fprintf(w, "Task ARN:  %s\n", o.TaskARN)
+}
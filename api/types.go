@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"github.com/degica/barcelona-cli/config"
 	"strings"
+	"time"
 )
 
 type DistrictResponse struct {
 	District    *District   `json:"district,omitempty"`
 	Districts   []*District `json:"districts,omitempty"`
 	Certificate string      `json:"certificate,omitempty"`
+	// Signs the district's host keys, when it has such a CA
+	HostCA string `json:"host_ca,omitempty"`
 }
 
 type DistrictRequest struct {
@@ -140,6 +143,17 @@ type RunEnv struct {
 	Vars map[string]string `yaml:"vars" json:"vars"`
 }
 
+// A named command in barcelona.yml that bcn task runs as a oneoff
+type Task struct {
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Command     string            `yaml:"command" json:"command"`
+	Memory      int               `yaml:"memory,omitempty" json:"memory,omitempty"`
+	User        string            `yaml:"user,omitempty" json:"user,omitempty"`
+	EnvVars     map[string]string `yaml:"env_vars,omitempty" json:"env_vars,omitempty"`
+	// Ask before running
+	Confirm bool `yaml:"confirm,omitempty" json:"confirm,omitempty"`
+}
+
 type Heritage struct {
 	Name           string                 `yaml:"name" json:"name"`
 	ImageName      string                 `yaml:"image_name" json:"image_name"`
@@ -152,6 +166,12 @@ type Heritage struct {
 	Environment    EnvironmentVariableSet `yaml:"environment" json:"environment"`
 	Token          string                 `json:"token,omitempty"`
 	RunEnv         *RunEnv                `yaml:"run_env,omitempty" json:"run_env,omitempty"`
+	// Name of another environment in barcelona.yml this one inherits from
+	Extends string `yaml:"extends,omitempty" json:"-"`
+	// Only set on heritages returned by Barcelona
+	District *District `yaml:"-" json:"district,omitempty"`
+	// Used by bcn task only and never sent to Barcelona
+	Tasks map[string]*Task `yaml:"tasks,omitempty" json:"-"`
 }
 
 func (h *Heritage) FillinDefaults() {
@@ -179,10 +199,23 @@ type Service struct {
 	Hosts            []*Host        `yaml:"hosts" json:"hosts"`
 	Listeners        []*Listener    `yaml:"listeners,omitempty" json:"listeners,omitempty"`
 	// Response only parameters
-	Status       string `json:"string,omitempty"`
+	Status       string `json:"status,omitempty"`
 	RunningCount int    `json:"running_count,omitempty"`
 	PendingCount int    `json:"pending_count,omitempty"`
 	DesiredCount int    `json:"desired_count,omitempty"`
+	// ECS deployments of the service. A rollout has finished once only
+	// the PRIMARY deployment is left
+	Deployments []*ServiceDeployment `yaml:"-" json:"deployments,omitempty"`
+}
+
+type ServiceDeployment struct {
+	// PRIMARY for the newest deployment, ACTIVE for ones being replaced
+	Status         string    `json:"status"`
+	TaskDefinition string    `json:"task_definition"`
+	RunningCount   int       `json:"running_count"`
+	PendingCount   int       `json:"pending_count"`
+	DesiredCount   int       `json:"desired_count"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 func (s *Service) FillinDefaults() {
@@ -220,8 +253,8 @@ type RuleCondition struct {
 }
 
 type ScheduledTask struct {
-	Schedule string `json:"schedule"`
-	Command  string `json:"command"`
+	Schedule string `yaml:"schedule" json:"schedule"`
+	Command  string `yaml:"command" json:"command"`
 }
 
 type PortMapping struct {
@@ -239,9 +272,15 @@ type Host struct {
 }
 
 type OneoffResponse struct {
-	Oneoff      *Oneoff `json:"oneoff"`
-	Oneoffs     *Oneoff `json:"oneoffs"`
-	Certificate string  `json:"certificate"`
+	Oneoff      *Oneoff   `json:"oneoff"`
+	Oneoffs     []*Oneoff `json:"oneoffs"`
+	Certificate string    `json:"certificate"`
+	HostCA      string    `json:"host_ca,omitempty"`
+}
+
+type SsmParametersDeleteResponse struct {
+	DeletedParameters []string `json:"deleted_parameters"`
+	InvalidParameters []string `json:"invalid_parameters"`
 }
 
 type Oneoff struct {
@@ -258,6 +297,20 @@ type Oneoff struct {
 	District              *District `json:"district"`
 }
 
+type Release struct {
+	Version     int       `json:"version"`
+	Description string    `json:"description,omitempty"`
+	ImageTag    string    `json:"image_tag,omitempty"`
+	DeployedBy  string    `json:"deployed_by,omitempty"`
+	CreatedAt   string    `json:"created_at"`
+	Heritage    *Heritage `json:"heritage,omitempty"`
+}
+
+type ReleaseResponse struct {
+	Release  *Release   `json:"release,omitempty"`
+	Releases []*Release `json:"releases,omitempty"`
+}
+
 type EndpointResponse struct {
 	Endpoint  *Endpoint   `json:"endpoint"`
 	Endpoints []*Endpoint `json:"endpoints"`
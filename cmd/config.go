@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+)
+
+var ConfigCommand = cli.Command{
+	Name:  "config",
+	Usage: "Inspect barcelona.yml",
+	Subcommands: []cli.Command{
+		{
+			Name:  "render",
+			Usage: "Print the fully resolved heritage of an environment as it would be sent to Barcelona",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				cli.StringFlag{
+					Name:  "tag, t",
+					Usage: "Tag of docker image",
+				},
+				varFlag,
+			},
+			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				h, err := buildHeritage(c.String("environment"), c.String("tag"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				// A resolved heritage has no table form
+				var jsonErr error
+				err = render(h, func(w io.Writer) {
+					jsonErr = utils.NewRenderer(utils.OutputJSON, w).Render(h, nil)
+				})
+				if err != nil {
+					return err
+				}
+				if jsonErr != nil {
+					return cli.NewExitError(jsonErr.Error(), 1)
+				}
+				return nil
+			},
+		},
+	},
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+)
+
+var CpCommand = cli.Command{
+	Name:      "cp",
+	Usage:     "Copy files to and from container instances and oneoff containers. Remote paths are DISTRICT:IP:/path, DISTRICT:EC2_INSTANCE_ID:/path or ONEOFF_ID:/path",
+	ArgsUsage: "SOURCE DESTINATION",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "recursive, r",
+			Usage: "Copy directories",
+		},
+		cli.StringFlag{
+			Name:  "environment, e",
+			Usage: "Environment of the heritage a oneoff belongs to",
+		},
+		cli.StringFlag{
+			Name:  "heritage-name, H",
+			Usage: "Heritage a oneoff belongs to",
+		},
+		cli.StringFlag{
+			Name:  "district, d",
+			Usage: "District of a oneoff. By default it is looked up from the heritage",
+		},
+		cli.BoolFlag{
+			Name:  "sudo",
+			Usage: "Run as root on the container instance, e.g. for files only root can read",
+		},
+		cli.BoolFlag{
+			Name:  "no-progress",
+			Usage: "Don't show progress. It is only shown on a terminal",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if len(c.Args()) != 2 {
+			return cli.NewExitError("SOURCE and DESTINATION are required", 1)
+		}
+		src := operations.ParseCpSpec(c.Args().Get(0))
+		dst := operations.ParseCpSpec(c.Args().Get(1))
+
+		// Only oneoffs need a heritage, so barcelona.yml is optional
+		heritageName := c.String("heritage-name")
+		if src.OneoffID > 0 || dst.OneoffID > 0 {
+			name, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+			if err == nil {
+				heritageName = name
+			} else if len(c.String("environment")) > 0 || len(heritageName) > 0 {
+				return cli.NewExitError(err.Error(), 1)
+			}
+		}
+
+		oper := operations.NewCpOperation(
+			api.DefaultClient,
+			src,
+			dst,
+			c.Bool("recursive"),
+			c.Bool("sudo"),
+			!c.Bool("no-progress") && utils.IsTerminal(os.Stderr),
+			heritageName,
+			c.String("district"),
+			config.Get(),
+			&utils.CommandRunner{},
+			os.Stderr,
+		)
+		return operations.Execute(oper)
+	},
+}
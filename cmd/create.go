@@ -23,8 +23,14 @@ var CreateCommand = cli.Command{
 			Value: "latest",
 			Usage: "District name",
 		},
+		varFlag,
 	},
 	Action: func(c *cli.Context) error {
+		err := setHeritageConfigVars(c.StringSlice("var"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
 		h, err := LoadEnvironment(c.String("environment"))
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
@@ -36,8 +42,6 @@ var CreateCommand = cli.Command{
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
-		resp.Print()
-
-		return nil
+		return printHeritage(resp)
 	},
 }
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Number of upcoming run times shown by cron list
+const cronNextRuns = 3
+
+type scheduledTaskItem struct {
+	Index    int         `json:"index"`
+	Schedule string      `json:"schedule"`
+	Command  string      `json:"command"`
+	Interval string      `json:"interval,omitempty"`
+	NextRuns []time.Time `json:"next_runs"`
+}
+
+var CronCommand = cli.Command{
+	Name:  "cron",
+	Usage: "Inspect and run the scheduled tasks defined in barcelona.yml",
+	Subcommands: []cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the scheduled tasks of an environment with their next run times in UTC",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				varFlag,
+			},
+			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				env, err := LoadEnvironment(c.String("environment"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				return printScheduledTasks(env.ScheduledTasks, time.Now())
+			},
+		},
+		{
+			Name:      "run",
+			Usage:     "Run a scheduled task's command now",
+			ArgsUsage: "INDEX|PATTERN",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				cli.BoolFlag{
+					Name:  "detach, D",
+					Usage: "Detach mode",
+				},
+				cli.StringSliceFlag{
+					Name:  "envvar, E",
+					Usage: "Environment variable to pass to task. Overrides --env-file and run_env.vars in barcelona.yml",
+				},
+				cli.StringSliceFlag{
+					Name:  "env-file",
+					Usage: "Dotenv file with environment variables to pass to task. Overrides run_env.vars in barcelona.yml",
+				},
+				cli.DurationFlag{
+					Name:  "start-timeout",
+					Value: 10 * time.Minute,
+					Usage: "Maximum time to wait for the task to start. The task is stopped when it runs out. 0 waits forever",
+				},
+				cli.BoolFlag{
+					Name:  "no-tty",
+					Usage: "Run without a terminal, e.g. in CI. Turned on when stdout is not a terminal",
+				},
+				varFlag,
+			},
+			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				if len(c.Args()) == 0 {
+					return cli.NewExitError("Scheduled task index or pattern is required", 1)
+				}
+
+				env, err := LoadEnvironment(c.String("environment"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				task, err := findScheduledTask(env.ScheduledTasks, strings.Join(c.Args(), " "))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				envVarMap := map[string]string{}
+				if env.RunEnv != nil {
+					for k, v := range env.RunEnv.Vars {
+						envVarMap[k] = v
+					}
+				}
+				err = mergeEnvVars(envVarMap, c.StringSlice("env-file"), c.StringSlice("envvar"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				fmt.Fprintf(operations.NoticeWriter(), "Running %s (%s)\n", task.Command, task.Schedule)
+
+				detach := c.Bool("detach")
+				params := oneoffParams(task.Command, envVarMap, 0, "", detach)
+
+				err = connectToHeritage(params, env.Name, detach, sshOptions(c), c.Duration("start-timeout"))
+				if _, ok := err.(cli.ExitCoder); ok {
+					return err
+				}
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+// Picks a scheduled task by its 1-based index in cron list, or by a
+// pattern that must appear in exactly one task's command
+func findScheduledTask(tasks []*api.ScheduledTask, arg string) (*api.ScheduledTask, error) {
+	if i, err := strconv.Atoi(arg); err == nil {
+		if i < 1 || i > len(tasks) {
+			return nil, fmt.Errorf("There is no scheduled task %d. There are %d", i, len(tasks))
+		}
+		return tasks[i-1], nil
+	}
+
+	var matches []*api.ScheduledTask
+	for _, task := range tasks {
+		if strings.Contains(task.Command, arg) {
+			matches = append(matches, task)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("No scheduled task matches %q", arg)
+	case 1:
+		return matches[0], nil
+	}
+
+	commands := make([]string, len(matches))
+	for i, task := range matches {
+		commands[i] = "  " + task.Command
+	}
+	return nil, fmt.Errorf("%d scheduled tasks match %q, use the index instead:\n%s", len(matches), arg, strings.Join(commands, "\n"))
+}
+
+func printScheduledTasks(tasks []*api.ScheduledTask, now time.Time) error {
+	items := make([]scheduledTaskItem, 0, len(tasks))
+	nextRuns := make([]string, 0, len(tasks))
+	for i, task := range tasks {
+		item := scheduledTaskItem{
+			Index:    i + 1,
+			Schedule: task.Schedule,
+			Command:  task.Command,
+			NextRuns: []time.Time{},
+		}
+
+		s, err := utils.ParseSchedule(task.Schedule)
+		switch {
+		case err != nil:
+			nextRuns = append(nextRuns, "invalid schedule")
+		case s.IsRate():
+			item.Interval = s.Interval()
+			nextRuns = append(nextRuns, item.Interval)
+		default:
+			var times []string
+			t := now
+			for n := 0; n < cronNextRuns; n++ {
+				t = s.Next(t)
+				if t.IsZero() {
+					break
+				}
+				item.NextRuns = append(item.NextRuns, t)
+				times = append(times, t.Format("2006-01-02 15:04"))
+			}
+			if len(times) == 0 {
+				times = append(times, "never")
+			}
+			nextRuns = append(nextRuns, strings.Join(times, ", "))
+		}
+
+		items = append(items, item)
+	}
+
+	return render(items, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"#", "Schedule", "Command", "Next Runs (UTC)"})
+		table.SetBorder(false)
+		table.SetAutoWrapText(false)
+		for i, item := range items {
+			table.Append([]string{strconv.Itoa(item.Index), item.Schedule, item.Command, nextRuns[i]})
+		}
+		table.Render()
+	})
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+)
+
+var testScheduledTasks = []*api.ScheduledTask{
+	{Schedule: "cron(0 3 * * ? *)", Command: "rake reports:nightly"},
+	{Schedule: "rate(1 hour)", Command: "rake cache:warm"},
+	{Schedule: "cron(0 9 ? * MON *)", Command: "rake reports:weekly"},
+}
+
+func Example_cron_list() {
+	config.Output = "json"
+	defer func() { config.Output = "" }()
+
+	printScheduledTasks(testScheduledTasks, time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC))
+	// Output:
+	// [
+	//   {
+	//     "index": 1,
+	//     "schedule": "cron(0 3 * * ? *)",
+	//     "command": "rake reports:nightly",
+	//     "next_runs": [
+	//       "2024-02-01T03:00:00Z",
+	//       "2024-02-02T03:00:00Z",
+	//       "2024-02-03T03:00:00Z"
+	//     ]
+	//   },
+	//   {
+	//     "index": 2,
+	//     "schedule": "rate(1 hour)",
+	//     "command": "rake cache:warm",
+	//     "interval": "every hour",
+	//     "next_runs": []
+	//   },
+	//   {
+	//     "index": 3,
+	//     "schedule": "cron(0 9 ? * MON *)",
+	//     "command": "rake reports:weekly",
+	//     "next_runs": [
+	//       "2024-02-05T09:00:00Z",
+	//       "2024-02-12T09:00:00Z",
+	//       "2024-02-19T09:00:00Z"
+	//     ]
+	//   }
+	// ]
+}
+
+func TestFindScheduledTask(t *testing.T) {
+	cases := map[string]string{
+		"1":      "rake reports:nightly",
+		"3":      "rake reports:weekly",
+		"cache":  "rake cache:warm",
+		"weekly": "rake reports:weekly",
+	}
+	for arg, expected := range cases {
+		task, err := findScheduledTask(testScheduledTasks, arg)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", arg, err)
+			continue
+		}
+		if task.Command != expected {
+			t.Errorf("Expected %q for %q but got %q", expected, arg, task.Command)
+		}
+	}
+
+	for _, arg := range []string{"0", "4", "reports", "db:migrate"} {
+		if _, err := findScheduledTask(testScheduledTasks, arg); err == nil {
+			t.Errorf("Expected an error for %q", arg)
+		}
+	}
+}
@@ -3,8 +3,15 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
 	"github.com/urfave/cli"
 )
 
@@ -28,6 +35,33 @@ var DeployCommand = cli.Command{
 			Name:  "quiet, q",
 			Usage: "Do not print output if successful. By default it is true",
 		},
+		cli.BoolFlag{
+			Name:  "wait, w",
+			Usage: "Wait until all services have finished rolling out",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: 15 * time.Minute,
+			Usage: "Maximum time to wait for the rollout when --wait is given",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show the changes against the live heritage without deploying. Exits with 2 when there are changes",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "Deploy every heritage in the project that defines the environment. Configs are listed in " + DeployManifestFileName + " at the git root, or searched for",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Value: 4,
+			Usage: "Number of heritages deployed at the same time with --all",
+		},
+		cli.BoolFlag{
+			Name:  "fail-fast",
+			Usage: "Stop starting new deploys with --all once one has failed",
+		},
+		varFlag,
 	},
 	Action: func(c *cli.Context) error {
 		env := c.String("environment")
@@ -35,8 +69,54 @@ var DeployCommand = cli.Command{
 		token := c.String("heritage-token")
 		quiet := c.Bool("quiet")
 
+		err := setHeritageConfigVars(c.StringSlice("var"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if c.Bool("all") {
+			if len(token) > 0 || c.Bool("dry-run") {
+				return cli.NewExitError("--all cannot be used with --heritage-token or --dry-run", 1)
+			}
+
+			pwd, err := os.Getwd()
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			err = doDeployAll(findProjectRoot(pwd), deployAllOptions{
+				env:         env,
+				tag:         tag,
+				wait:        c.Bool("wait"),
+				timeout:     c.Duration("timeout"),
+				concurrency: c.Int("concurrency"),
+				failFast:    c.Bool("fail-fast"),
+			})
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			return nil
+		}
+
+		if c.Bool("dry-run") {
+			changed, err := doDeployDryRun(env, tag)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			if changed {
+				return cli.NewExitError("", 2)
+			}
+			return nil
+		}
+
+		// Following the rollout needs a login, which a heritage token
+		// doesn't give
+		if c.Bool("wait") && len(token) > 0 && len(config.Get().LoadLogin().GetToken()) == 0 {
+			return cli.NewExitError("--wait with --heritage-token needs a login to follow the rollout. Run bcn login or drop --wait", 1)
+		}
+
+		since := time.Now()
 		var heritage *api.Heritage
-		var err error
 		if len(token) > 0 {
 			heritage, err = doDeployWithHeritageToken(env, tag, token)
 		} else {
@@ -47,15 +127,27 @@ var DeployCommand = cli.Command{
 		}
 
 		if !quiet {
-			heritage.Print()
+			err = printHeritage(heritage)
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.Bool("wait") {
+			oper := operations.NewDeployWaitOperation(api.DefaultClient, heritage, since, c.Duration("timeout"), operations.NoticeWriter())
+			return operations.Execute(oper)
 		}
 
 		return nil
 	},
 }
 
-func doDeploy(env, tag string) (*api.Heritage, error) {
-	h, err := LoadEnvironment(env)
+func buildHeritage(env, tag string) (*api.Heritage, error) {
+	return buildHeritageFile(HeritageConfigFilePath, env, tag)
+}
+
+func buildHeritageFile(path, env, tag string) (*api.Heritage, error) {
+	h, err := loadEnvironmentFile(path, env)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +155,59 @@ func doDeploy(env, tag string) (*api.Heritage, error) {
 	h.FillinDefaults()
 	h.ImageTag = tag
 
+	return h, nil
+}
+
+type deployDryRunResult struct {
+	Heritage string           `json:"heritage"`
+	Changes  []heritageChange `json:"changes"`
+}
+
+func doDeployDryRun(env, tag string) (bool, error) {
+	h, err := buildHeritage(env, tag)
+	if err != nil {
+		return false, err
+	}
+
+	live, err := api.DefaultClient.ShowHeritage(h.Name)
+	if err != nil {
+		return false, err
+	}
+	if live == nil {
+		return false, errors.New("No such heritage")
+	}
+
+	changes := diffHeritages(live, h)
+	result := deployDryRunResult{
+		Heritage: h.Name,
+		Changes:  changes,
+	}
+	err = render(result, func(w io.Writer) {
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "No changes")
+			return
+		}
+		for _, change := range changes {
+			fmt.Fprintln(w, change)
+		}
+		fmt.Fprintf(w, "%d change(s)\n", len(changes))
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(changes) > 0, nil
+}
+
+func doDeploy(env, tag string) (*api.Heritage, error) {
+	h, err := buildHeritage(env, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return patchHeritage(h)
+}
+
+func patchHeritage(h *api.Heritage) (*api.Heritage, error) {
 	j, err := json.Marshal(h)
 	if err != nil {
 		return nil, err
@@ -78,6 +223,9 @@ func doDeploy(env, tag string) (*api.Heritage, error) {
 	if err != nil {
 		return nil, err
 	}
+	if hResp.Heritage == nil {
+		return nil, errors.New("Barcelona didn't return the deployed heritage")
+	}
 	return hResp.Heritage, nil
 }
 
@@ -105,5 +253,8 @@ func doDeployWithHeritageToken(env, tag, token string) (*api.Heritage, error) {
 	if err != nil {
 		return nil, err
 	}
+	if hResp.Heritage == nil {
+		return nil, errors.New("Barcelona didn't return the deployed heritage")
+	}
 	return hResp.Heritage, nil
 }
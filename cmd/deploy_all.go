@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/olekukonko/tablewriter"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// A manifest at the project root lists the configs to deploy with --all
+// instead of searching the whole tree for them
+const DeployManifestFileName = "barcelona-manifest.yml"
+
+type deployManifest struct {
+	Configs []string `yaml:"configs"`
+}
+
+// Directories never searched for barcelona.yml
+var skippedConfigDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+}
+
+type deployAllOptions struct {
+	env         string
+	tag         string
+	wait        bool
+	timeout     time.Duration
+	concurrency int
+	failFast    bool
+}
+
+type deployAllResult struct {
+	path     string
+	label    string
+	heritage string
+	status   string
+	err      error
+}
+
+// Returns the git root above dir, or dir itself outside of a git repository
+func findProjectRoot(dir string) string {
+	current := dir
+	for {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+func findHeritageConfigs(root string) ([]string, error) {
+	manifestPath := filepath.Join(root, DeployManifestFileName)
+	if b, err := ioutil.ReadFile(manifestPath); err == nil {
+		var manifest deployManifest
+		err = yaml.Unmarshal(b, &manifest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", manifestPath, err)
+		}
+
+		var paths []string
+		for _, p := range manifest.Configs {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(root, p)
+			}
+			if info, err := os.Stat(p); err == nil && info.IsDir() {
+				p = filepath.Join(p, HeritageConfigFileName)
+			}
+			paths = append(paths, p)
+		}
+		return paths, nil
+	}
+
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (name[0] == '.' || skippedConfigDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == HeritageConfigFileName {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func deployOne(path string, opts deployAllOptions, out *utils.PrefixWriter) (string, error) {
+	defer out.Flush()
+
+	h, err := buildHeritageFile(path, opts.env, opts.tag)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(out, "Deploying %s\n", h.Name)
+	since := time.Now()
+	heritage, err := patchHeritage(h)
+	if err != nil {
+		return h.Name, err
+	}
+
+	if opts.wait {
+		oper := operations.NewDeployWaitOperation(api.DefaultClient, heritage, since, opts.timeout, out)
+		return h.Name, operations.Execute(oper)
+	}
+
+	fmt.Fprintf(out, "Deployed %s\n", h.Name)
+	return h.Name, nil
+}
+
+func doDeployAll(root string, opts deployAllOptions) error {
+	paths, err := findHeritageConfigs(root)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("No %s found under %s", HeritageConfigFileName, root)
+	}
+
+	// Only configs that define the environment take part
+	var results []*deployAllResult
+	var targets []*deployAllResult
+	failed := false
+	for _, path := range paths {
+		label, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			label = filepath.Dir(path)
+		}
+		result := &deployAllResult{path: path, label: label, status: "skipped"}
+
+		config, err := loadHeritageConfigFile(path)
+		if err != nil {
+			result.status = "failed"
+			result.err = err
+			results = append(results, result)
+			failed = true
+			continue
+		}
+		if config.Environments[opts.env] == nil {
+			continue
+		}
+		results = append(results, result)
+		targets = append(targets, result)
+	}
+
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	var outLock sync.Mutex
+	var failedLock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.concurrency)
+
+	for _, result := range targets {
+		sem <- struct{}{}
+
+		failedLock.Lock()
+		stop := failed && opts.failFast
+		failedLock.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(result *deployAllResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			out := utils.NewPrefixWriter(operations.NoticeWriter(), "["+result.label+"] ", &outLock)
+			name, err := deployOne(result.path, opts, out)
+			result.heritage = name
+			if err != nil {
+				fmt.Fprintln(out, err)
+				out.Flush()
+				result.status = "failed"
+				result.err = err
+
+				failedLock.Lock()
+				failed = true
+				failedLock.Unlock()
+				return
+			}
+			result.status = "deployed"
+		}(result)
+	}
+	wg.Wait()
+
+	err = printDeployAllResults(results)
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return fmt.Errorf("One or more heritages failed to deploy")
+	}
+	return nil
+}
+
+type deployAllSummary struct {
+	Config   string `json:"config"`
+	Heritage string `json:"heritage"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+}
+
+func printDeployAllResults(results []*deployAllResult) error {
+	summaries := []deployAllSummary{}
+	for _, r := range results {
+		summary := deployAllSummary{
+			Config:   r.label,
+			Heritage: r.heritage,
+			Result:   r.status,
+		}
+		if r.err != nil {
+			summary.Error = r.err.Error()
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return render(summaries, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Config", "Heritage", "Result", "Error"})
+		table.SetBorder(false)
+		for _, s := range summaries {
+			table.Append([]string{s.Config, s.Heritage, s.Result, s.Error})
+		}
+		table.Render()
+	})
+}
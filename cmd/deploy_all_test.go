@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHeritageConfigs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"api", "web/frontend", "node_modules/pkg", ".hidden"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+		ioutil.WriteFile(filepath.Join(root, dir, HeritageConfigFileName), []byte(""), 0644)
+	}
+
+	paths, err := findHeritageConfigs(root)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	expected := []string{
+		filepath.Join(root, "api", HeritageConfigFileName),
+		filepath.Join(root, "web/frontend", HeritageConfigFileName),
+	}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], paths[i])
+		}
+	}
+}
+
+func TestFindHeritageConfigsManifest(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "api"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "api", HeritageConfigFileName), []byte(""), 0644)
+	ioutil.WriteFile(filepath.Join(root, "web.yml"), []byte(""), 0644)
+	ioutil.WriteFile(filepath.Join(root, DeployManifestFileName), []byte("configs:\n  - api\n  - web.yml\n"), 0644)
+
+	paths, err := findHeritageConfigs(root)
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	expected := []string{
+		filepath.Join(root, "api", HeritageConfigFileName),
+		filepath.Join(root, "web.yml"),
+	}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Errorf("Expected %v but got %v", expected, paths)
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
 	"strings"
 
 	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
 	"github.com/degica/barcelona-cli/utils"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
@@ -78,9 +79,7 @@ var DistrictCommand = cli.Command{
 					return cli.NewExitError(err.Error(), 1)
 				}
 
-				printDistrict(district)
-
-				return nil
+				return printDistrict(district)
 			},
 		},
 		{
@@ -91,9 +90,7 @@ var DistrictCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printDistricts(districts)
-
-				return nil
+				return printDistricts(districts)
 			},
 		},
 		{
@@ -110,9 +107,7 @@ var DistrictCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printDistrict(district)
-
-				return nil
+				return printDistrict(district)
 			},
 		},
 		{
@@ -157,7 +152,10 @@ var DistrictCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printDistrict(district)
+				err = printDistrict(district)
+				if err != nil {
+					return err
+				}
 
 				err = applyOrNotice(districtName, c.Bool("apply"))
 				if err != nil {
@@ -251,7 +249,10 @@ var DistrictCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printPlugin(plugin)
+				err = printPlugin(plugin)
+				if err != nil {
+					return err
+				}
 
 				err = applyOrNotice(districtName, c.Bool("apply"))
 				if err != nil {
@@ -381,66 +382,72 @@ func applyOrNotice(districtName string, apply bool) error {
 		if err != nil {
 			return err
 		}
-		fmt.Println("Applying network stack")
+		fmt.Fprintln(operations.NoticeWriter(), "Applying network stack")
 	} else {
-		fmt.Println("The change has not been applied to the hosts.")
-		fmt.Println("Run `bcn district apply` to apply the change")
+		fmt.Fprintln(operations.NoticeWriter(), "The change has not been applied to the hosts.")
+		fmt.Fprintln(operations.NoticeWriter(), "Run `bcn district apply` to apply the change")
 	}
 
 	return nil
 }
 
-func printPlugin(p *api.Plugin) {
-	fmt.Printf("Name %s\n", p.Name)
-	for k, v := range p.Attributes {
-		fmt.Printf("%s: %s\n", k, v)
-	}
+func printPlugin(p *api.Plugin) error {
+	return render(p, func(w io.Writer) {
+		fmt.Fprintf(w, "Name %s\n", p.Name)
+		for k, v := range p.Attributes {
+			fmt.Fprintf(w, "%s: %s\n", k, v)
+		}
+	})
 }
 
-func printDistrict(d *api.District) {
-	fmt.Printf("Name: %s\n", d.Name)
-	fmt.Printf("Region: %s\n", d.Region)
-	fmt.Printf("Cluster Backend: %s\n", d.ClusterBackend)
-	fmt.Printf("Cluster Instance Type: %s\n", d.ClusterInstanceType)
-	fmt.Printf("Cluster Size: %d\n", d.ClusterSize)
-	fmt.Printf("S3 Bucket Name: %s\n", d.S3BucketName)
-	fmt.Printf("Stack Name: %s\n", d.StackName)
-	fmt.Printf("Stack Status: %s\n", d.StackStatus)
-	fmt.Printf("NAT Type: %s\n", d.NatType)
-	fmt.Printf("CIDR Block: %s\n", d.CidrBlock)
-	fmt.Printf("AWS Access Key ID: %s\n", d.AwsAccessKeyId)
-	fmt.Printf("AWS Role: %s\n", d.AwsRole)
-	fmt.Printf("Container Instances:\n")
-	for _, ci := range d.ContainerInstances {
-		fmt.Printf("  %s %s %s\n", ci.EC2InstanceID, ci.PrivateIPAddress, ci.Status)
-	}
+func printDistrict(d *api.District) error {
+	return render(d, func(w io.Writer) {
+		fmt.Fprintf(w, "Name: %s\n", d.Name)
+		fmt.Fprintf(w, "Region: %s\n", d.Region)
+		fmt.Fprintf(w, "Cluster Backend: %s\n", d.ClusterBackend)
+		fmt.Fprintf(w, "Cluster Instance Type: %s\n", d.ClusterInstanceType)
+		fmt.Fprintf(w, "Cluster Size: %d\n", d.ClusterSize)
+		fmt.Fprintf(w, "S3 Bucket Name: %s\n", d.S3BucketName)
+		fmt.Fprintf(w, "Stack Name: %s\n", d.StackName)
+		fmt.Fprintf(w, "Stack Status: %s\n", d.StackStatus)
+		fmt.Fprintf(w, "NAT Type: %s\n", d.NatType)
+		fmt.Fprintf(w, "CIDR Block: %s\n", d.CidrBlock)
+		fmt.Fprintf(w, "AWS Access Key ID: %s\n", d.AwsAccessKeyId)
+		fmt.Fprintf(w, "AWS Role: %s\n", d.AwsRole)
+		fmt.Fprintf(w, "Container Instances:\n")
+		for _, ci := range d.ContainerInstances {
+			fmt.Fprintf(w, "  %s %s %s\n", ci.EC2InstanceID, ci.PrivateIPAddress, ci.Status)
+		}
 
-	fmt.Printf("Heritages:\n")
-	for _, h := range d.Heritages {
-		fmt.Printf("  %s\n", h.Name)
-	}
+		fmt.Fprintf(w, "Heritages:\n")
+		for _, h := range d.Heritages {
+			fmt.Fprintf(w, "  %s\n", h.Name)
+		}
 
-	fmt.Printf("Notifications:\n")
-	for _, n := range d.Notifications {
-		fmt.Printf("  %d %s %s\n", n.ID, n.Target, n.Endpoint)
-	}
+		fmt.Fprintf(w, "Notifications:\n")
+		for _, n := range d.Notifications {
+			fmt.Fprintf(w, "  %d %s %s\n", n.ID, n.Target, n.Endpoint)
+		}
 
-	fmt.Printf("Plugins:\n")
-	for _, plugin := range d.Plugins {
-		attrs := ""
-		for k, v := range plugin.Attributes {
-			attrs += fmt.Sprintf("%s=%s ", k, v)
+		fmt.Fprintf(w, "Plugins:\n")
+		for _, plugin := range d.Plugins {
+			attrs := ""
+			for k, v := range plugin.Attributes {
+				attrs += fmt.Sprintf("%s=%s ", k, v)
+			}
+			fmt.Fprintf(w, "  %s: %s\n", plugin.Name, attrs)
 		}
-		fmt.Printf("  %s: %s\n", plugin.Name, attrs)
-	}
+	})
 }
 
-func printDistricts(ds []*api.District) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Region", "Instance Type", "Cluster Size", "AWS Role", "Access Key ID"})
-	table.SetBorder(false)
-	for _, d := range ds {
-		table.Append([]string{d.Name, d.Region, d.ClusterInstanceType, fmt.Sprintf("%d", d.ClusterSize), d.AwsRole, d.AwsAccessKeyId})
-	}
-	table.Render()
+func printDistricts(ds []*api.District) error {
+	return render(ds, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Name", "Region", "Instance Type", "Cluster Size", "AWS Role", "Access Key ID"})
+		table.SetBorder(false)
+		for _, d := range ds {
+			table.Append([]string{d.Name, d.Region, d.ClusterInstanceType, fmt.Sprintf("%d", d.ClusterSize), d.AwsRole, d.AwsAccessKeyId})
+		}
+		table.Render()
+	})
 }
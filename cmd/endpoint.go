@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/degica/barcelona-cli/api"
 	"github.com/degica/barcelona-cli/utils"
@@ -71,9 +71,7 @@ var EndpointCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEndpoint(eResp.Endpoint)
-
-				return nil
+				return printEndpoint(eResp.Endpoint)
 			},
 		},
 		{
@@ -102,9 +100,7 @@ var EndpointCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEndpoint(eResp.Endpoint)
-
-				return nil
+				return printEndpoint(eResp.Endpoint)
 			},
 		},
 		{
@@ -127,9 +123,7 @@ var EndpointCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEndpoints(eResp.Endpoints)
-
-				return nil
+				return printEndpoints(eResp.Endpoints)
 			},
 		},
 		{
@@ -176,9 +170,7 @@ var EndpointCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEndpoint(eResp.Endpoint)
-
-				return nil
+				return printEndpoint(eResp.Endpoint)
 			},
 		},
 		{
@@ -216,20 +208,24 @@ var EndpointCommand = cli.Command{
 	},
 }
 
-func printEndpoint(e *api.Endpoint) {
-	fmt.Printf("Name: %s\n", e.Name)
-	fmt.Printf("Public: %t\n", *e.Public)
-	fmt.Printf("SSL Policy: %s\n", e.SslPolicy)
-	fmt.Printf("Certificate ARN: %s\n", e.CertificateID)
-	fmt.Printf("DNS Name: %s\n", e.DNSName)
+func printEndpoint(e *api.Endpoint) error {
+	return render(e, func(w io.Writer) {
+		fmt.Fprintf(w, "Name: %s\n", e.Name)
+		fmt.Fprintf(w, "Public: %t\n", *e.Public)
+		fmt.Fprintf(w, "SSL Policy: %s\n", e.SslPolicy)
+		fmt.Fprintf(w, "Certificate ARN: %s\n", e.CertificateID)
+		fmt.Fprintf(w, "DNS Name: %s\n", e.DNSName)
+	})
 }
 
-func printEndpoints(es []*api.Endpoint) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "District", "Public", "SSL Policy", "Cert ID"})
-	table.SetBorder(false)
-	for _, e := range es {
-		table.Append([]string{e.Name, e.District.Name, fmt.Sprintf("%t", *e.Public), e.SslPolicy, e.CertificateID})
-	}
-	table.Render()
+func printEndpoints(es []*api.Endpoint) error {
+	return render(es, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Name", "District", "Public", "SSL Policy", "Cert ID"})
+		table.SetBorder(false)
+		for _, e := range es {
+			table.Append([]string{e.Name, e.District.Name, fmt.Sprintf("%t", *e.Public), e.SslPolicy, e.CertificateID})
+		}
+		table.Render()
+	})
 }
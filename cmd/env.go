@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/degica/barcelona-cli/api"
@@ -50,9 +51,7 @@ var EnvCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEnv(respHeritage.Heritage.EnvVars)
-
-				return nil
+				return printEnv(respHeritage.Heritage.EnvVars)
 			},
 		},
 		{
@@ -115,9 +114,7 @@ var EnvCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEnv(respHeritage.Heritage.EnvVars)
-
-				return nil
+				return printEnv(respHeritage.Heritage.EnvVars)
 			},
 		},
 		{
@@ -165,16 +162,16 @@ var EnvCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printEnv(respHeritage.Heritage.EnvVars)
-
-				return nil
+				return printEnv(respHeritage.Heritage.EnvVars)
 			},
 		},
 	},
 }
 
-func printEnv(es map[string]string) {
-	for name, value := range es {
-		fmt.Printf("%s: %s\n", name, value)
-	}
+func printEnv(es map[string]string) error {
+	return render(es, func(w io.Writer) {
+		for name, value := range es {
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	})
 }
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/degica/barcelona-cli/api"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Lists whose entries are merged by the given key instead of being replaced
+var mergeListKeys = map[string]string{
+	"services":        "name",
+	"listeners":       "endpoint",
+	"port_mappings":   "lb_port",
+	"hosts":           "hostname",
+	"scheduled_tasks": "command",
+	"environment":     "name",
+}
+
+// Entries of these lists and maps replace the inherited entry as a whole.
+// Merging an environment entry could leave both value and ssm_path set
+var replaceEntryKeys = map[string]bool{
+	"environment": true,
+}
+
+type rawHeritageConfig struct {
+	Environments map[string]map[interface{}]interface{} `yaml:"environments"`
+}
+
+// resolveExtends replaces every environment that has `extends` with
+// the result of deep merging it on top of the environment it extends
+func resolveExtends(data []byte, config *HeritageConfig) error {
+	var raw rawHeritageConfig
+	err := yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	for name, h := range config.Environments {
+		if h == nil || len(h.Extends) == 0 {
+			continue
+		}
+
+		merged, err := resolveEnvironment(raw.Environments, name, nil)
+		if err != nil {
+			return err
+		}
+
+		b, err := yaml.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		var resolved api.Heritage
+		err = yaml.Unmarshal(b, &resolved)
+		if err != nil {
+			return err
+		}
+		config.Environments[name] = &resolved
+	}
+
+	return nil
+}
+
+func resolveEnvironment(envs map[string]map[interface{}]interface{}, name string, chain []string) (map[interface{}]interface{}, error) {
+	for _, n := range chain {
+		if n == name {
+			return nil, fmt.Errorf("environment inheritance cycle: %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+
+	env, ok := envs[name]
+	if !ok {
+		return nil, fmt.Errorf("environment %s extends unknown environment %s", chain[len(chain)-1], name)
+	}
+
+	parent, ok := env["extends"].(string)
+	if !ok || len(parent) == 0 {
+		return env, nil
+	}
+
+	base, err := resolveEnvironment(envs, parent, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	merged := mergeYAML(base, env, "").(map[interface{}]interface{})
+	delete(merged, "extends")
+	return merged, nil
+}
+
+// mergeYAML deep merges over on top of base. key is the mapping key both
+// values were found under and decides how lists are merged
+func mergeYAML(base, over interface{}, key string) interface{} {
+	if over == nil {
+		return base
+	}
+
+	switch o := over.(type) {
+	case map[interface{}]interface{}:
+		b, ok := base.(map[interface{}]interface{})
+		if !ok {
+			return over
+		}
+		result := map[interface{}]interface{}{}
+		for k, v := range b {
+			result[k] = v
+		}
+		for k, v := range o {
+			if replaceEntryKeys[key] {
+				result[k] = v
+				continue
+			}
+			result[k] = mergeYAML(b[k], v, fmt.Sprint(k))
+		}
+		return result
+	case []interface{}:
+		b, ok := base.([]interface{})
+		idKey, mergeable := mergeListKeys[key]
+		if !ok || !mergeable {
+			return over
+		}
+		return mergeList(b, o, idKey, replaceEntryKeys[key])
+	}
+
+	return over
+}
+
+func listEntryID(entry interface{}, idKey string) (string, bool) {
+	m, ok := entry.(map[interface{}]interface{})
+	if !ok {
+		return "", false
+	}
+	id, ok := m[idKey]
+	if !ok || id == nil {
+		return "", false
+	}
+	return fmt.Sprint(id), true
+}
+
+func mergeList(base, over []interface{}, idKey string, replace bool) []interface{} {
+	result := make([]interface{}, len(base))
+	copy(result, base)
+
+	index := map[string]int{}
+	for i, entry := range result {
+		if id, ok := listEntryID(entry, idKey); ok {
+			index[id] = i
+		}
+	}
+
+	for _, entry := range over {
+		id, ok := listEntryID(entry, idKey)
+		if !ok {
+			result = append(result, entry)
+			continue
+		}
+		i, found := index[id]
+		if !found {
+			index[id] = len(result)
+			result = append(result, entry)
+			continue
+		}
+		if replace {
+			result[i] = entry
+		} else {
+			result[i] = mergeYAML(result[i], entry, "")
+		}
+	}
+
+	return result
+}
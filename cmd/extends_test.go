@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"testing"
+)
+
+const extendsConfig = `environments:
+  staging:
+    name: app-staging
+    image_name: app
+    run_env:
+      vars:
+        RAILS_ENV: staging
+        LOG_LEVEL: debug
+    environment:
+      - name: DATABASE_URL
+        ssm_path: /staging/database_url
+      - name: FEATURE_X
+        value: "on"
+    scheduled_tasks:
+      - schedule: rate(1 day)
+        command: rake cleanup
+    services:
+      - name: web
+        command: puma
+        memory: 256
+        listeners:
+          - endpoint: staging-ep
+            health_check_path: /health
+      - name: worker
+        command: rake jobs:work
+  production:
+    extends: staging
+    name: app-production
+    run_env:
+      vars:
+        RAILS_ENV: production
+    environment:
+      - name: DATABASE_URL
+        value: postgres://production
+    scheduled_tasks:
+      - schedule: rate(1 hour)
+        command: rake cleanup
+    services:
+      - name: web
+        memory: 1024
+        listeners:
+          - endpoint: production-ep
+      - name: scheduler
+        command: clockwork
+`
+
+func TestParseHeritageConfigExtends(t *testing.T) {
+	config, err := parseHeritageConfig([]byte(extendsConfig))
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	h := config.Environments["production"]
+	if h.Name != "app-production" || h.ImageName != "app" {
+		t.Errorf("Unexpected name or image name: %s %s", h.Name, h.ImageName)
+	}
+	if len(h.Extends) != 0 {
+		t.Errorf("Expected extends to be cleared but got %s", h.Extends)
+	}
+
+	if h.RunEnv.Vars["RAILS_ENV"] != "production" || h.RunEnv.Vars["LOG_LEVEL"] != "debug" {
+		t.Errorf("Unexpected run_env: %v", h.RunEnv.Vars)
+	}
+
+	if len(h.ScheduledTasks) != 1 || h.ScheduledTasks[0].Schedule != "rate(1 hour)" {
+		t.Errorf("Unexpected scheduled tasks: %v", h.ScheduledTasks)
+	}
+
+	env := map[string]string{}
+	for _, e := range h.Environment.Entries {
+		switch {
+		case e.Value != nil && e.SsmPath != nil:
+			t.Errorf("Expected %s to be replaced, not merged", e.Name)
+		case e.Value != nil:
+			env[e.Name] = *e.Value
+		case e.SsmPath != nil:
+			env[e.Name] = *e.SsmPath
+		}
+	}
+	if env["DATABASE_URL"] != "postgres://production" || env["FEATURE_X"] != "on" {
+		t.Errorf("Unexpected environment: %v", env)
+	}
+
+	names := []string{}
+	for _, s := range h.Services {
+		names = append(names, s.Name)
+	}
+	if len(names) != 3 || names[0] != "web" || names[1] != "worker" || names[2] != "scheduler" {
+		t.Fatalf("Unexpected services: %v", names)
+	}
+
+	web := h.Services[0]
+	if web.Command != "puma" || web.Memory != 1024 {
+		t.Errorf("Unexpected web service: %s %d", web.Command, web.Memory)
+	}
+	if len(web.Listeners) != 2 || web.Listeners[0].Endpoint != "staging-ep" || web.Listeners[1].Endpoint != "production-ep" {
+		t.Errorf("Unexpected listeners: %v", web.Listeners)
+	}
+
+	staging := config.Environments["staging"]
+	if staging.Services[0].Memory != 256 || len(staging.Services) != 2 {
+		t.Errorf("Expected staging to be left untouched")
+	}
+}
+
+func TestParseHeritageConfigExtendsCycle(t *testing.T) {
+	data := []byte(`environments:
+  a:
+    extends: b
+  b:
+    extends: a
+`)
+
+	_, err := parseHeritageConfig(data)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if err.Error() != "environment inheritance cycle: a -> b -> a" && err.Error() != "environment inheritance cycle: b -> a -> b" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestParseHeritageConfigExtendsUnknown(t *testing.T) {
+	data := []byte(`environments:
+  a:
+    extends: nothing
+`)
+
+	_, err := parseHeritageConfig(data)
+	if err == nil || err.Error() != "environment a extends unknown environment nothing" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+type heritageChange struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+func (c heritageChange) String() string {
+	switch c.Kind {
+	case "+":
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case "-":
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	default:
+		return fmt.Sprintf("~ %s: %s => %s", c.Path, c.Old, c.New)
+	}
+}
+
+type heritageDiff struct {
+	changes []heritageChange
+}
+
+func (d *heritageDiff) compare(path string, old, new interface{}) {
+	o := diffValue(old)
+	n := diffValue(new)
+	if o != n {
+		d.changes = append(d.changes, heritageChange{Kind: "~", Path: path, Old: o, New: n})
+	}
+}
+
+func (d *heritageDiff) added(path string, new interface{}) {
+	d.changes = append(d.changes, heritageChange{Kind: "+", Path: path, New: diffValue(new)})
+}
+
+func (d *heritageDiff) removed(path string, old interface{}) {
+	d.changes = append(d.changes, heritageChange{Kind: "-", Path: path, Old: diffValue(old)})
+}
+
+func diffValue(v interface{}) string {
+	switch val := v.(type) {
+	case *string:
+		if val == nil {
+			return "<none>"
+		}
+		return fmt.Sprintf("%q", *val)
+	case *bool:
+		if val == nil {
+			return "<none>"
+		}
+		return fmt.Sprintf("%t", *val)
+	case string:
+		return fmt.Sprintf("%q", val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// diffHeritages returns the changes deploying local on top of live would make
+func diffHeritages(live, local *api.Heritage) []heritageChange {
+	d := &heritageDiff{}
+
+	d.compare("image_name", live.ImageName, local.ImageName)
+	// An empty tag keeps whatever is deployed
+	if len(local.ImageTag) > 0 {
+		d.compare("image_tag", live.ImageTag, local.ImageTag)
+	}
+	d.compare("before_deploy", live.BeforeDeploy, local.BeforeDeploy)
+
+	diffServices(d, live.Services, local.Services)
+	diffScheduledTasks(d, live.ScheduledTasks, local.ScheduledTasks)
+	diffEnvironment(d, live.Environment.Entries, local.Environment.Entries)
+
+	return d.changes
+}
+
+func diffServices(d *heritageDiff, live, local []*api.Service) {
+	liveByName := map[string]*api.Service{}
+	for _, s := range live {
+		liveByName[s.Name] = s
+	}
+	localByName := map[string]*api.Service{}
+	for _, s := range local {
+		localByName[s.Name] = s
+	}
+
+	for _, s := range live {
+		if localByName[s.Name] == nil {
+			d.removed("services["+s.Name+"]", s.Command)
+		}
+	}
+
+	for _, s := range local {
+		path := "services[" + s.Name + "]"
+		l := liveByName[s.Name]
+		if l == nil {
+			d.added(path, s.Command)
+			continue
+		}
+		d.compare(path+".service_type", l.ServiceType, s.ServiceType)
+		d.compare(path+".command", l.Command, s.Command)
+		d.compare(path+".cpu", l.Cpu, s.Cpu)
+		d.compare(path+".memory", l.Memory, s.Memory)
+		d.compare(path+".public", l.Public, s.Public)
+		d.compare(path+".force_ssl", l.ForceSsl, s.ForceSsl)
+		d.compare(path+".web_container_port", l.WebContainerPort, s.WebContainerPort)
+		diffListeners(d, path, l.Listeners, s.Listeners)
+		diffPortMappings(d, path, l.PortMappings, s.PortMappings)
+	}
+}
+
+func diffListeners(d *heritageDiff, prefix string, live, local []*api.Listener) {
+	liveByEndpoint := map[string]*api.Listener{}
+	for _, l := range live {
+		liveByEndpoint[l.Endpoint] = l
+	}
+	localByEndpoint := map[string]*api.Listener{}
+	for _, l := range local {
+		localByEndpoint[l.Endpoint] = l
+	}
+
+	for _, l := range live {
+		if localByEndpoint[l.Endpoint] == nil {
+			d.removed(prefix+".listeners["+l.Endpoint+"]", l.HealthCheckPath)
+		}
+	}
+
+	for _, l := range local {
+		path := prefix + ".listeners[" + l.Endpoint + "]"
+		o := liveByEndpoint[l.Endpoint]
+		if o == nil {
+			d.added(path, l.HealthCheckPath)
+			continue
+		}
+		d.compare(path+".health_check_path", o.HealthCheckPath, l.HealthCheckPath)
+		d.compare(path+".health_check_interval", o.HealthCheckInterval, l.HealthCheckInterval)
+		d.compare(path+".health_check_timeout", o.HealthCheckTimeout, l.HealthCheckTimeout)
+		d.compare(path+".healthy_threshold_count", o.HealthyThresholdCount, l.HealthyThresholdCount)
+		d.compare(path+".unhealthy_threshold_count", o.UnhealthyThresholdCount, l.UnhealthyThresholdCount)
+		d.compare(path+".rule_priority", o.RulePriority, l.RulePriority)
+		d.compare(path+".rule_conditions", ruleConditionsString(o.RuleConditions), ruleConditionsString(l.RuleConditions))
+	}
+}
+
+func ruleConditionsString(conds []api.RuleCondition) string {
+	var parts []string
+	for _, c := range conds {
+		parts = append(parts, c.Type+"="+c.Value)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func diffPortMappings(d *heritageDiff, prefix string, live, local []*api.PortMapping) {
+	liveByPort := map[int]*api.PortMapping{}
+	for _, p := range live {
+		liveByPort[p.LbPort] = p
+	}
+	localByPort := map[int]*api.PortMapping{}
+	for _, p := range local {
+		localByPort[p.LbPort] = p
+	}
+
+	for _, p := range live {
+		if localByPort[p.LbPort] == nil {
+			d.removed(fmt.Sprintf("%s.port_mappings[%d]", prefix, p.LbPort), p.ContainerPort)
+		}
+	}
+
+	for _, p := range local {
+		path := fmt.Sprintf("%s.port_mappings[%d]", prefix, p.LbPort)
+		o := liveByPort[p.LbPort]
+		if o == nil {
+			d.added(path, p.ContainerPort)
+			continue
+		}
+		d.compare(path+".container_port", o.ContainerPort, p.ContainerPort)
+		d.compare(path+".host_port", o.HostPort, p.HostPort)
+		d.compare(path+".protocol", o.Protocol, p.Protocol)
+		d.compare(path+".enable_proxy_protocol", o.EnableProxyProtocol, p.EnableProxyProtocol)
+	}
+}
+
+func diffScheduledTasks(d *heritageDiff, live, local []*api.ScheduledTask) {
+	key := func(t *api.ScheduledTask) string {
+		return t.Schedule + " " + t.Command
+	}
+	liveKeys := map[string]bool{}
+	for _, t := range live {
+		liveKeys[key(t)] = true
+	}
+	localKeys := map[string]bool{}
+	for _, t := range local {
+		localKeys[key(t)] = true
+	}
+
+	for _, t := range live {
+		if !localKeys[key(t)] {
+			d.removed("scheduled_tasks", key(t))
+		}
+	}
+	for _, t := range local {
+		if !liveKeys[key(t)] {
+			d.added("scheduled_tasks", key(t))
+		}
+	}
+}
+
+func envPairString(e *api.EnvironmentPair) string {
+	switch {
+	case e.Value != nil:
+		return "value " + diffValue(e.Value)
+	case e.ValueFrom != nil:
+		return "value_from " + diffValue(e.ValueFrom)
+	case e.SsmPath != nil:
+		return "ssm_path " + diffValue(e.SsmPath)
+	}
+	return "<none>"
+}
+
+func diffEnvironment(d *heritageDiff, live, local []*api.EnvironmentPair) {
+	liveByName := map[string]*api.EnvironmentPair{}
+	for _, e := range live {
+		liveByName[e.Name] = e
+	}
+	localByName := map[string]*api.EnvironmentPair{}
+	for _, e := range local {
+		localByName[e.Name] = e
+	}
+
+	var names []string
+	for name := range liveByName {
+		names = append(names, name)
+	}
+	for name := range localByName {
+		if liveByName[name] == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := "environment[" + name + "]"
+		o := liveByName[name]
+		n := localByName[name]
+		switch {
+		case n == nil:
+			d.changes = append(d.changes, heritageChange{Kind: "-", Path: path, Old: envPairString(o)})
+		case o == nil:
+			d.changes = append(d.changes, heritageChange{Kind: "+", Path: path, New: envPairString(n)})
+		default:
+			if envPairString(o) != envPairString(n) {
+				d.changes = append(d.changes, heritageChange{Kind: "~", Path: path, Old: envPairString(o), New: envPairString(n)})
+			}
+		}
+	}
+}
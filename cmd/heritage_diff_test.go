@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+func TestDiffHeritagesNoChanges(t *testing.T) {
+	h := &api.Heritage{
+		Name:      "nginx",
+		ImageName: "nginx",
+		Services: []*api.Service{
+			{Name: "web", Command: "nginx", Memory: 256},
+		},
+	}
+
+	changes := diffHeritages(h, h)
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes but got %v", changes)
+	}
+}
+
+func TestDiffHeritages(t *testing.T) {
+	value := "bar"
+	live := &api.Heritage{
+		Name:      "nginx",
+		ImageName: "nginx",
+		ImageTag:  "v1",
+		Services: []*api.Service{
+			{
+				Name:    "web",
+				Command: "nginx",
+				Memory:  256,
+				Listeners: []*api.Listener{
+					{Endpoint: "ep", HealthCheckPath: "/"},
+				},
+			},
+			{Name: "worker", Command: "rake jobs:work"},
+		},
+		ScheduledTasks: []*api.ScheduledTask{
+			{Schedule: "rate(1 minute)", Command: "echo hello"},
+		},
+	}
+	local := &api.Heritage{
+		Name:      "nginx",
+		ImageName: "nginx",
+		ImageTag:  "v2",
+		Services: []*api.Service{
+			{
+				Name:    "web",
+				Command: "nginx",
+				Memory:  512,
+				Listeners: []*api.Listener{
+					{Endpoint: "ep", HealthCheckPath: "/health"},
+				},
+				PortMappings: []*api.PortMapping{
+					{LbPort: 80, ContainerPort: 3000},
+				},
+			},
+		},
+		Environment: api.EnvironmentVariableSet{
+			Entries: []*api.EnvironmentPair{{Name: "FOO", Value: &value}},
+		},
+	}
+
+	expected := []string{
+		`~ image_tag: "v1" => "v2"`,
+		`- services[worker]: "rake jobs:work"`,
+		`~ services[web].memory: 256 => 512`,
+		`~ services[web].listeners[ep].health_check_path: "/" => "/health"`,
+		`+ services[web].port_mappings[80]: 3000`,
+		`- scheduled_tasks: "rate(1 minute) echo hello"`,
+		`+ environment[FOO]: value "bar"`,
+	}
+
+	changes := diffHeritages(live, local)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes but got %v", len(expected), changes)
+	}
+	for i, change := range changes {
+		if change.String() != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], change.String())
+		}
+	}
+}
+
+func TestDiffHeritagesIgnoresEmptyTag(t *testing.T) {
+	live := &api.Heritage{Name: "nginx", ImageTag: "v1"}
+	local := &api.Heritage{Name: "nginx"}
+
+	changes := diffHeritages(live, local)
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes but got %v", changes)
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// Variables given with --var. They take precedence over the process environment
+var HeritageConfigVars = map[string]string{}
+
+var varFlag = cli.StringSliceFlag{
+	Name:  "var",
+	Usage: "Variable for ${VAR} placeholders in barcelona.yml, as KEY=VALUE",
+}
+
+// Matches $${...} (an escaped placeholder), ${VAR} and ${VAR:-default}
+var placeholderRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+type interpolationError struct {
+	Line int
+	Name string
+}
+
+func (err interpolationError) Error() string {
+	return fmt.Sprintf("line %d: variable %s is not defined and has no default", err.Line, err.Name)
+}
+
+func setHeritageConfigVars(pairs []string) error {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return fmt.Errorf("--var %s is not valid. It must be KEY=VALUE", pair)
+		}
+		vars[kv[0]] = kv[1]
+	}
+	HeritageConfigVars = vars
+	return nil
+}
+
+func lookupVar(name string, vars map[string]string) (string, bool) {
+	if v, ok := vars[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// interpolateHeritageConfig expands ${VAR} and ${VAR:-default} placeholders.
+// $${VAR} is left in the output as ${VAR} and comment lines are not expanded
+func interpolateHeritageConfig(data []byte, vars map[string]string) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		var err error
+		lines[i] = placeholderRegexp.ReplaceAllStringFunc(line, func(match string) string {
+			if strings.HasPrefix(match, "$$") {
+				return match[1:]
+			}
+
+			m := placeholderRegexp.FindStringSubmatch(match)
+			name, hasDefault, def := m[1], len(m[2]) > 0, m[3]
+
+			value, ok := lookupVar(name, vars)
+			if ok && (len(value) > 0 || !hasDefault) {
+				return value
+			}
+			if hasDefault {
+				return def
+			}
+			if err == nil {
+				err = interpolationError{Line: i + 1, Name: name}
+			}
+			return match
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestInterpolateHeritageConfig(t *testing.T) {
+	os.Setenv("BCN_TEST_IMAGE", "from-env")
+	os.Setenv("BCN_TEST_EMPTY", "")
+	defer os.Unsetenv("BCN_TEST_IMAGE")
+	defer os.Unsetenv("BCN_TEST_EMPTY")
+
+	data := []byte(`# ${BCN_TEST_UNDEFINED} in a comment
+image_name: ${BCN_TEST_IMAGE}
+hostname: ${BCN_TEST_HOST}.example.com
+memory: ${BCN_TEST_MEMORY:-512}
+empty: ${BCN_TEST_EMPTY:-fallback}
+literal: $${BCN_TEST_IMAGE}`)
+
+	result, err := interpolateHeritageConfig(data, map[string]string{"BCN_TEST_HOST": "staging"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	expected := `# ${BCN_TEST_UNDEFINED} in a comment
+image_name: from-env
+hostname: staging.example.com
+memory: 512
+empty: fallback
+literal: ${BCN_TEST_IMAGE}`
+	if string(result) != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, result)
+	}
+}
+
+func TestInterpolateHeritageConfigVarTakesPrecedence(t *testing.T) {
+	os.Setenv("BCN_TEST_IMAGE", "from-env")
+	defer os.Unsetenv("BCN_TEST_IMAGE")
+
+	result, err := interpolateHeritageConfig([]byte("image_name: ${BCN_TEST_IMAGE}"), map[string]string{"BCN_TEST_IMAGE": "from-var"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if string(result) != "image_name: from-var" {
+		t.Errorf("Unexpected result: %s", result)
+	}
+}
+
+func TestInterpolateHeritageConfigUndefined(t *testing.T) {
+	data := []byte("name: app\nimage_name: ${BCN_TEST_UNDEFINED}\n")
+
+	_, err := interpolateHeritageConfig(data, map[string]string{})
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if err.Error() != "line 2: variable BCN_TEST_UNDEFINED is not defined and has no default" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestSetHeritageConfigVars(t *testing.T) {
+	defer func() { HeritageConfigVars = map[string]string{} }()
+
+	err := setHeritageConfigVars([]string{"A=1", "B=x=y"})
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+	if HeritageConfigVars["A"] != "1" || HeritageConfigVars["B"] != "x=y" {
+		t.Errorf("Unexpected vars: %v", HeritageConfigVars)
+	}
+
+	err = setHeritageConfigVars([]string{"A"})
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
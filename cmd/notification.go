@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 
 	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
 	"github.com/urfave/cli"
 )
 
@@ -61,9 +63,7 @@ var NotificationCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printNotification(eResp.Notification)
-
-				return nil
+				return printNotification(eResp.Notification)
 			},
 		},
 		{
@@ -92,9 +92,7 @@ var NotificationCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printNotification(eResp.Notification)
-
-				return nil
+				return printNotification(eResp.Notification)
 			},
 		},
 		{
@@ -132,7 +130,7 @@ var NotificationCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				fmt.Println(string(b))
+				fmt.Fprintln(operations.NoticeWriter(), string(b))
 
 				resp, err := api.DefaultClient.Request("PATCH", fmt.Sprintf("/districts/%s/notifications/%d", c.String("district"), id), bytes.NewBuffer(b))
 				if err != nil {
@@ -143,9 +141,7 @@ var NotificationCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				printNotification(eResp.Notification)
-
-				return nil
+				return printNotification(eResp.Notification)
 			},
 		},
 		{
@@ -187,8 +183,10 @@ func parseIDArg(c *cli.Context) (int, error) {
 	return id, nil
 }
 
-func printNotification(n *api.Notification) {
-	fmt.Printf("ID:       %d\n", n.ID)
-	fmt.Printf("Target:   %s\n", n.Target)
-	fmt.Printf("Endpoint: %s\n", n.Endpoint)
+func printNotification(n *api.Notification) error {
+	return render(n, func(w io.Writer) {
+		fmt.Fprintf(w, "ID:       %d\n", n.ID)
+		fmt.Fprintf(w, "Target:   %s\n", n.Target)
+		fmt.Fprintf(w, "Endpoint: %s\n", n.Endpoint)
+	})
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+)
+
+var oneoffFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "environment, e",
+		Usage: "Environment of heritage",
+	},
+	cli.StringFlag{
+		Name:  "heritage-name, H",
+		Usage: "Heritage name",
+	},
+	cli.StringFlag{
+		Name:  "district, d",
+		Usage: "District name. By default it is looked up from the heritage",
+	},
+}
+
+var OneoffCommand = cli.Command{
+	Name:  "oneoff",
+	Usage: "Manage oneoff tasks started with bcn run",
+	Subcommands: []cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List oneoff tasks",
+			Flags:  oneoffFlags,
+			Action: oneoffAction(operations.List, false),
+		},
+		{
+			Name:      "show",
+			Usage:     "Show a oneoff task",
+			ArgsUsage: "ID",
+			Flags:     oneoffFlags,
+			Action:    oneoffAction(operations.Show, true),
+		},
+		{
+			Name:      "wait",
+			Usage:     "Wait until a oneoff task stops and exit with its exit code",
+			ArgsUsage: "ID",
+			Flags:     oneoffFlags,
+			Action:    oneoffAction(operations.Wait, true),
+		},
+		{
+			Name:      "stop",
+			Usage:     "Stop a oneoff task",
+			ArgsUsage: "ID",
+			Flags:     oneoffFlags,
+			Action:    oneoffAction(operations.Stop, true),
+		},
+		oneoffAttachCommand,
+		{
+			Name:      "logs",
+			Usage:     "Print the output of a oneoff task's container",
+			ArgsUsage: "ID",
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "follow, f",
+					Usage: "Keep printing output until the task stops",
+				},
+				cli.IntFlag{
+					Name:  "tail",
+					Usage: "Number of lines from the end to print. All lines by default",
+				},
+			}, oneoffFlags...),
+			Action: func(c *cli.Context) error {
+				heritageName, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				id, err := oneoffID(c)
+				if err != nil {
+					return err
+				}
+
+				oper := operations.NewOneoffLogsOperation(
+					api.DefaultClient,
+					heritageName,
+					c.String("district"),
+					id,
+					c.Bool("follow"),
+					c.Int("tail"),
+					config.Get(),
+					&utils.CommandRunner{},
+				)
+				return operations.Execute(oper)
+			},
+		},
+	},
+}
+
+func oneoffAction(opType operations.OperationType, needsID bool) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		heritageName, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		id := 0
+		if needsID {
+			id, err = oneoffID(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		oper := operations.NewOneoffOperation(heritageName, c.String("district"), opType, id, api.DefaultClient)
+		return operations.Execute(oper)
+	}
+}
+
+func oneoffID(c *cli.Context) (int, error) {
+	idStr := c.Args().Get(0)
+	if len(idStr) == 0 {
+		return 0, cli.NewExitError("Oneoff ID is required", 1)
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, cli.NewExitError(err.Error(), 1)
+	}
+	return id, nil
+}
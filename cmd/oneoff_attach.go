@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+)
+
+const lastOneoffFileName = "last_oneoff"
+
+// The oneoff of the last bcn run session, kept until it ends
+type lastOneoff struct {
+	ID       int    `json:"id"`
+	Heritage string `json:"heritage"`
+	District string `json:"district"`
+}
+
+func lastOneoffPath() string {
+	return filepath.Join(config.Get().GetConfigDir(), lastOneoffFileName)
+}
+
+func saveLastOneoff(path string, o *lastOneoff) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0775)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func loadLastOneoff(path string) (*lastOneoff, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.New("No bcn run session to reattach to")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var o lastOneoff
+	err = json.Unmarshal(b, &o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &o, nil
+}
+
+func clearLastOneoff(path string) {
+	os.Remove(path)
+}
+
+var oneoffAttachCommand = cli.Command{
+	Name:      "attach",
+	Usage:     "Reconnect to a running oneoff after the connection dropped",
+	ArgsUsage: "ID",
+	Flags: append([]cli.Flag{
+		cli.BoolFlag{
+			Name:  "last",
+			Usage: "Reattach to the oneoff of the last bcn run session",
+		},
+		cli.BoolFlag{
+			Name:  "no-tty",
+			Usage: "Run without a terminal, e.g. in CI. Turned on when stdout is not a terminal",
+		},
+	}, oneoffFlags...),
+	Action: func(c *cli.Context) error {
+		var target *lastOneoff
+		if c.Bool("last") {
+			last, err := loadLastOneoff(lastOneoffPath())
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			target = last
+		} else {
+			id, err := oneoffID(c)
+			if err != nil {
+				return err
+			}
+			heritageName, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			target = &lastOneoff{ID: id, Heritage: heritageName, District: c.String("district")}
+		}
+
+		if len(target.District) == 0 {
+			h, err := api.DefaultClient.ShowHeritage(target.Heritage)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			if h == nil || h.District == nil {
+				return cli.NewExitError(fmt.Sprintf("Could not find the district of %s. Please specify it with --district", target.Heritage), 1)
+			}
+			target.District = h.District.Name
+		}
+
+		return attachToOneoff(target, sshOptions(c))
+	},
+}
+
+func attachToOneoff(target *lastOneoff, opts utils.SshOptions) error {
+	path := fmt.Sprintf("/districts/%s/heritages/%s/oneoffs/%d", target.District, target.Heritage, target.ID)
+	waiter := operations.NewOneoffWaiter(api.DefaultClient, path, nil)
+
+	oneoff, err := waiter.Fetch()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	switch oneoff.Status {
+	case "RUNNING":
+	case "STOPPED":
+		fmt.Fprintf(os.Stderr, "Oneoff %d has already stopped\n", oneoff.ID)
+		clearLastOneoff(lastOneoffPath())
+		return operations.OneoffExitError(oneoff)
+	default:
+		return cli.NewExitError(fmt.Sprintf("Oneoff %d is %s", oneoff.ID, oneoff.Status), 1)
+	}
+
+	district := oneoff.District
+	if district == nil || len(district.ContainerInstances) == 0 {
+		district, err = api.DefaultClient.ShowDistrict(target.District)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	if district == nil {
+		return cli.NewExitError("Could not find district "+target.District, 1)
+	}
+
+	progress := io.Writer(os.Stdout)
+	if !opts.TTY {
+		progress = os.Stderr
+	}
+	return attachOneoffSession(oneoff, target.Heritage, district, waiter, opts, progress)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLastOneoff(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".bcn", lastOneoffFileName)
+
+	_, err := loadLastOneoff(path)
+	if err == nil || err.Error() != "No bcn run session to reattach to" {
+		t.Errorf("Expected no session but got %v", err)
+	}
+
+	err = saveLastOneoff(path, &lastOneoff{ID: 12, Heritage: "nginx", District: "default"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	last, err := loadLastOneoff(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if last.ID != 12 || last.Heritage != "nginx" || last.District != "default" {
+		t.Errorf("Unexpected oneoff %+v", last)
+	}
+
+	clearLastOneoff(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", path)
+	}
+}
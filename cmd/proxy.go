@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/urfave/cli"
+)
+
+var ProxyCommand = cli.Command{
+	Name:      "proxy",
+	Usage:     "Open a SOCKS5 proxy into the district's VPC through the bastion. Destinations are logged with --debug",
+	ArgsUsage: "DISTRICT_NAME",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "listen, l",
+			Value: "127.0.0.1:1080",
+			Usage: "Address to listen on",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		oper := operations.NewProxyOperation(
+			api.DefaultClient,
+			c.Args().Get(0),
+			c.String("listen"),
+			config.Get(),
+			operations.NoticeWriter(),
+		)
+		return operations.Execute(oper)
+	},
+}
@@ -1,6 +1,13 @@
 package cmd
 
-import "github.com/urfave/cli"
+import (
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+)
 
 var ReleaseCommand = cli.Command{
 	Name:  "release",
@@ -9,15 +16,73 @@ var ReleaseCommand = cli.Command{
 		{
 			Name:  "list",
 			Usage: "List releases",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				cli.StringFlag{
+					Name:  "heritage-name, H",
+					Usage: "Heritage name",
+				},
+			},
 			Action: func(c *cli.Context) error {
-				return nil
+				heritageName, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				oper := operations.NewReleaseOperation(heritageName, operations.List, 0, false, false, 0, api.DefaultClient, utils.NewStdinInputReader())
+				return operations.Execute(oper)
 			},
 		},
 		{
 			Name:  "rollback",
 			Usage: "Roll back to the previous release",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				cli.StringFlag{
+					Name:  "heritage-name, H",
+					Usage: "Heritage name",
+				},
+				cli.IntFlag{
+					Name:  "to",
+					Usage: "Version to roll back to. Defaults to the release before the current one",
+				},
+				cli.BoolFlag{
+					Name:  "no-confirmation",
+					Usage: "Roll back without asking for confirmation",
+				},
+				cli.BoolFlag{
+					Name:  "wait, w",
+					Usage: "Wait until all services have finished rolling out",
+				},
+				cli.DurationFlag{
+					Name:  "timeout",
+					Value: 15 * time.Minute,
+					Usage: "Maximum time to wait for the rollout when --wait is given",
+				},
+			},
 			Action: func(c *cli.Context) error {
-				return nil
+				heritageName, err := resolveHeritageName(c.String("environment"), c.String("heritage-name"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				oper := operations.NewReleaseOperation(
+					heritageName,
+					operations.Rollback,
+					c.Int("to"),
+					c.Bool("no-confirmation"),
+					c.Bool("wait"),
+					c.Duration("timeout"),
+					api.DefaultClient,
+					utils.NewStdinInputReader(),
+				)
+				return operations.Execute(oper)
 			},
 		},
 	},
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 	"time"
 
 	"github.com/degica/barcelona-cli/api"
@@ -40,9 +40,10 @@ func (com *DeployReviewApp) Execute() error {
 	if err != nil {
 		return cli.NewExitError(err.Error(), 1)
 	}
-	fmt.Printf("Domain: %s\n", rResp.ReviewApp.Domain)
-
-	return nil
+	app := rResp.ReviewApp
+	return render(app, func(w io.Writer) {
+		fmt.Fprintf(w, "Domain: %s\n", app.Domain)
+	})
 }
 
 var ReviewCommand = cli.Command{
@@ -64,8 +65,14 @@ var ReviewCommand = cli.Command{
 				cli.StringFlag{
 					Name: "retention, r",
 				},
+				varFlag,
 			},
 			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
 				subject := c.Args().Get(0)
 				tag := c.String("tag")
 				token := c.String("token")
@@ -157,9 +164,7 @@ var ReviewCommand = cli.Command{
 					return cli.NewExitError(err.Error(), 1)
 				}
 
-				renderApps(review_apps)
-
-				return nil
+				return renderApps(review_apps)
 			},
 		},
 		ReviewGroupCommand,
@@ -181,12 +186,14 @@ func getReviewApps(groupName string) ([]*api.ReviewApp, error) {
 	return appResp.ReviewApps, nil
 }
 
-func renderApps(apps []*api.ReviewApp) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Subject", "Domain", ""})
-	table.SetBorder(false)
-	for _, app := range apps {
-		table.Append([]string{app.Subject, app.Domain, app.Heritage.Name})
-	}
-	table.Render()
+func renderApps(apps []*api.ReviewApp) error {
+	return render(apps, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Subject", "Domain", ""})
+		table.SetBorder(false)
+		for _, app := range apps {
+			table.Append([]string{app.Subject, app.Domain, app.Heritage.Name})
+		}
+		table.Render()
+	})
 }
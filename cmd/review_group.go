@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/degica/barcelona-cli/api"
 	"github.com/olekukonko/tablewriter"
@@ -70,15 +70,11 @@ var ReviewGroupCommand = cli.Command{
 
 				var rResp api.ReviewGroupResponse
 				err = json.Unmarshal(resp, &rResp)
-				group := rResp.ReviewGroup
-
-				fmt.Println("Name: ", group.Name)
-				fmt.Println("Base Domain: ", group.BaseDomain)
-				fmt.Println("Endpoint: ", group.Endpoint.Name)
-				fmt.Println("Token: ", *group.Token)
-				fmt.Println("Apps")
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
 
-				return nil
+				return printReviewGroup(rResp.ReviewGroup)
 			},
 		},
 		{
@@ -94,17 +90,8 @@ var ReviewGroupCommand = cli.Command{
 				if err != nil {
 					return cli.NewExitError(err.Error(), 1)
 				}
-				groups := rResp.ReviewGroups
-
-				table := tablewriter.NewWriter(os.Stdout)
-				table.SetHeader([]string{"Name", "Base Domain", "Endpoint"})
-				table.SetBorder(false)
-				for _, g := range groups {
-					table.Append([]string{g.Name, g.BaseDomain, g.Endpoint.Name})
-				}
-				table.Render()
 
-				return nil
+				return printReviewGroups(rResp.ReviewGroups)
 			},
 		},
 		{
@@ -122,3 +109,25 @@ var ReviewGroupCommand = cli.Command{
 		},
 	},
 }
+
+func printReviewGroup(group *api.ReviewGroup) error {
+	return render(group, func(w io.Writer) {
+		fmt.Fprintln(w, "Name: ", group.Name)
+		fmt.Fprintln(w, "Base Domain: ", group.BaseDomain)
+		fmt.Fprintln(w, "Endpoint: ", group.Endpoint.Name)
+		fmt.Fprintln(w, "Token: ", *group.Token)
+		fmt.Fprintln(w, "Apps")
+	})
+}
+
+func printReviewGroups(groups []*api.ReviewGroup) error {
+	return render(groups, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Name", "Base Domain", "Endpoint"})
+		table.SetBorder(false)
+		for _, g := range groups {
+			table.Append([]string{g.Name, g.BaseDomain, g.Endpoint.Name})
+		}
+		table.Render()
+	})
+}
@@ -2,15 +2,21 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/degica/barcelona-cli/api"
 	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
 	"github.com/degica/barcelona-cli/utils"
 	"github.com/urfave/cli"
 )
@@ -42,14 +48,33 @@ var RunCommand = cli.Command{
 		},
 		cli.StringSliceFlag{
 			Name:  "envvar, E",
-			Usage: "Environment variable to pass to task",
+			Usage: "Environment variable to pass to task. Overrides --env-file and run_env.vars in barcelona.yml",
+		},
+		cli.StringSliceFlag{
+			Name:  "env-file",
+			Usage: "Dotenv file with environment variables to pass to task. Overrides run_env.vars in barcelona.yml. Later files override earlier ones",
 		},
 		cli.StringFlag{
 			Name:  "b, branch",
 			Usage: "Git branch name",
 		},
+		cli.DurationFlag{
+			Name:  "start-timeout",
+			Value: 10 * time.Minute,
+			Usage: "Maximum time to wait for the task to start. The task is stopped when it runs out. 0 waits forever",
+		},
+		cli.BoolFlag{
+			Name:  "no-tty",
+			Usage: "Run without a terminal, e.g. in CI. Turned on when stdout is not a terminal",
+		},
+		varFlag,
 	},
 	Action: func(c *cli.Context) error {
+		err := setHeritageConfigVars(c.StringSlice("var"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
 		envName := c.String("environment")
 		heritageName := c.String("heritage-name")
 		branchName := c.String("branch")
@@ -87,14 +112,9 @@ var RunCommand = cli.Command{
 			heritageName = env.Name
 		}
 
-		if len(envVars) > 0 {
-			varmap, err := checkEnvVars(envVars)
-			if err != nil {
-				return cli.NewExitError(err.Error(), 1)
-			}
-			for k, v := range varmap {
-				envVarMap[k] = v
-			}
+		err = mergeEnvVars(envVarMap, c.StringSlice("env-file"), envVars)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
 		}
 
 		if len(c.Args()) == 0 {
@@ -102,22 +122,12 @@ var RunCommand = cli.Command{
 		}
 
 		command := strings.Join(c.Args(), " ")
-		params := map[string]interface{}{
-			"interactive": !detach,
-			"command":     command,
-			"env_vars":    envVarMap,
-		}
-		memory := c.Int("memory")
-		if memory > 0 {
-			params["memory"] = memory
-		}
+		params := oneoffParams(command, envVarMap, c.Int("memory"), c.String("user"), detach)
 
-		user := c.String("user")
-		if user != "" {
-			params["user"] = user
+		err = connectToHeritage(params, heritageName, detach, sshOptions(c), c.Duration("start-timeout"))
+		if _, ok := err.(cli.ExitCoder); ok {
+			return err
 		}
-		err := connectToHeritage(params, heritageName, detach)
-
 		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
@@ -126,6 +136,47 @@ var RunCommand = cli.Command{
 	},
 }
 
+// Adds the variables of env files and -E flags to envVarMap. Later
+// sources override earlier ones: envVarMap < --env-file < -E
+func mergeEnvVars(envVarMap map[string]string, envFiles []string, envVars []string) error {
+	for _, path := range envFiles {
+		varmap, err := utils.LoadDotenvFile(path)
+		if err != nil {
+			return err
+		}
+		for k, v := range varmap {
+			envVarMap[k] = v
+		}
+	}
+
+	if len(envVars) > 0 {
+		varmap, err := checkEnvVars(envVars)
+		if err != nil {
+			return err
+		}
+		for k, v := range varmap {
+			envVarMap[k] = v
+		}
+	}
+	return nil
+}
+
+// Builds the request body for POST /heritages/NAME/oneoffs
+func oneoffParams(command string, envVarMap map[string]string, memory int, user string, detach bool) map[string]interface{} {
+	params := map[string]interface{}{
+		"interactive": !detach,
+		"command":     command,
+		"env_vars":    envVarMap,
+	}
+	if memory > 0 {
+		params["memory"] = memory
+	}
+	if user != "" {
+		params["user"] = user
+	}
+	return params
+}
+
 func loadEnvVars(envName string) (map[string]string, error) {
 	result := make(map[string]string)
 	if len(envName) > 0 {
@@ -145,23 +196,86 @@ func loadEnvVars(envName string) (map[string]string, error) {
 func checkEnvVars(envvarSlice []string) (map[string]string, error) {
 	var result = make(map[string]string)
 
-	re := regexp.MustCompile(`^([A-Z_]+)=(.*)$`)
+	re := regexp.MustCompile(`(?s)^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
 	for _, envvar := range envvarSlice {
 		if !re.Match([]byte(envvar)) {
-			return nil, errors.New(fmt.Sprintf("Env Variable  %s  is not valid. Name must have PASCAL_CASE=", envvar))
+			return nil, errors.New(fmt.Sprintf("Env Variable  %s  is not valid. Name must be letters, digits and underscores and not start with a digit", envvar))
 		}
 		result[re.FindStringSubmatch(envvar)[1]] = re.FindStringSubmatch(envvar)[2]
 	}
 	return result, nil
 }
 
-func connectToHeritage(params map[string]interface{}, heritageName string, detach bool) error {
+// RunAttachAlias turns bcn run attach into bcn oneoff attach. The alias
+// works on the arguments rather than as a subcommand of run so that run's
+// own arguments are parsed as before. Only attach right after run is
+// taken, so bcn run -- attach still runs a remote command named attach.
+// globalFlags tell which arguments before run are flag values
+func RunAttachAlias(args []string, globalFlags []cli.Flag) []string {
+	withValue := map[string]bool{}
+	for _, f := range globalFlags {
+		switch f.(type) {
+		case cli.BoolFlag, cli.BoolTFlag:
+			continue
+		}
+		for _, name := range strings.Split(f.GetName(), ",") {
+			withValue[strings.TrimSpace(name)] = true
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			if arg != "run" || i+1 >= len(args) || args[i+1] != "attach" {
+				return args
+			}
+			aliased := append([]string{}, args[:i]...)
+			aliased = append(aliased, "oneoff")
+			return append(aliased, args[i+1:]...)
+		}
+		if withValue[strings.TrimLeft(arg, "-")] {
+			i++
+		}
+	}
+	return args
+}
+
+// Uses a PTY unless --no-tty is given or the output isn't a terminal
+func sshOptions(c *cli.Context) utils.SshOptions {
+	if c.Bool("no-tty") || !utils.IsTerminal(os.Stdout) {
+		return nonInteractiveSshOptions()
+	}
+	return utils.DefaultSshOptions()
+}
+
+// Streams stdout and stderr separately without a PTY. stdin is only
+// forwarded when something is piped into bcn
+func nonInteractiveSshOptions() utils.SshOptions {
+	opts := utils.SshOptions{
+		TTY:    false,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if utils.IsPiped(os.Stdin) {
+		opts.Stdin = os.Stdin
+	}
+	return opts
+}
+
+// startTimeout limits how long the task may stay PENDING. Zero waits forever
+func connectToHeritage(params map[string]interface{}, heritageName string, detach bool, opts utils.SshOptions, startTimeout time.Duration) error {
 	j, err := json.Marshal(params)
 
 	if err != nil {
 		return err
 	}
 
+	// Installed before the oneoff is created so an interrupt at any
+	// point until we attach stops it rather than leaving it behind.
+	// Once attached, the session handles interrupts itself
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
 	resp, err := api.DefaultClient.Post("/heritages/"+heritageName+"/oneoffs", bytes.NewBuffer(j))
 	if err != nil {
 		return err
@@ -174,61 +288,158 @@ func connectToHeritage(params map[string]interface{}, heritageName string, detac
 	}
 
 	oneoff := respOneoff.Oneoff
-	certificate := respOneoff.Certificate
 
 	if detach {
-		PrintOneoff(oneoff)
-		return nil
+		return PrintOneoff(oneoff)
 	}
 
-	fmt.Println("Waiting for the process to start")
+	path := fmt.Sprintf("/districts/%s/heritages/%s/oneoffs/%d", oneoff.District.Name, heritageName, oneoff.ID)
+	waiter := operations.NewOneoffWaiter(api.DefaultClient, path, nil)
+	if ctx.Err() != nil {
+		stopOneoff(waiter, oneoff.ID)
+		return cli.NewExitError("Interrupted", 130)
+	}
 
-LOOP:
-	for {
-		path := fmt.Sprintf("/districts/%s/heritages/%s/oneoffs/%d", oneoff.District.Name, heritageName, oneoff.ID)
-		resp, err := api.DefaultClient.Get(path, nil)
-		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
-		}
-		var respOneoff api.OneoffResponse
-		err = json.Unmarshal(resp, &respOneoff)
-		if err != nil {
-			return cli.NewExitError(err.Error(), 1)
+	// Progress goes to stderr without a TTY so stdout only has the
+	// command's output
+	progress := io.Writer(os.Stdout)
+	if !opts.TTY {
+		progress = os.Stderr
+	}
+	fmt.Fprintln(progress, "Waiting for the process to start")
+
+	current, err := waiter.WaitForStart(ctx, startTimeout)
+	if err != nil {
+		if current != nil {
+			// Interrupted or timed out
+			stopOneoff(waiter, oneoff.ID)
 		}
-		switch respOneoff.Oneoff.Status {
-		case "RUNNING":
-			break LOOP
-		case "PENDING":
-			time.Sleep(3 * time.Second)
-		default:
-			// INACTIVE or STOPPED
-			return cli.NewExitError("Unexpected task status "+respOneoff.Oneoff.Status, 1)
+		if err == context.Canceled {
+			return cli.NewExitError("Interrupted", 130)
 		}
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	switch current.Status {
+	case "RUNNING":
+	case "STOPPED":
+		// The task finished before we could connect
+		return operations.OneoffExitError(current)
+	default:
+		// INACTIVE
+		return cli.NewExitError("Unexpected task status "+current.Status, 1)
+	}
+
+	// The certificate is signed along with the oneoff
+	_, err = utils.NewCertCache(config.Get()).Put(&utils.DistrictCertificate{
+		District:    oneoff.District.Name,
+		BastionIP:   oneoff.District.BastionIP,
+		Certificate: respOneoff.Certificate,
+		HostCA:      respOneoff.HostCA,
+	})
+	if err != nil {
+		stopOneoff(waiter, oneoff.ID)
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	stopSignals()
+	if ctx.Err() != nil {
+		stopOneoff(waiter, oneoff.ID)
+		return cli.NewExitError("Interrupted", 130)
 	}
 
-	fmt.Println("Connecting to the process")
+	// The container is only known once the task has been placed
+	if len(current.InteractiveRunCommand) == 0 {
+		current.InteractiveRunCommand = oneoff.InteractiveRunCommand
+	}
+	return attachOneoffSession(current, heritageName, oneoff.District, waiter, opts, progress)
+}
+
+// Stops a oneoff we are not going to attach to
+func stopOneoff(waiter *operations.OneoffWaiter, id int) {
+	fmt.Fprintf(os.Stderr, "Stopping oneoff %d\n", id)
+	if err := waiter.Stop(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not stop oneoff %d: %s\n", id, err)
+	}
+}
+
+// Connects to a running oneoff and returns its exit status. The oneoff
+// is remembered while connected so bcn oneoff attach --last can get back
+// in when the connection drops
+func attachOneoffSession(oneoff *api.Oneoff, heritageName string, district *api.District, waiter *operations.OneoffWaiter, opts utils.SshOptions, progress io.Writer) error {
+	fmt.Fprintln(progress, "Connecting to the process")
 
 	var matchedCI *api.ContainerInstance
-	for _, ci := range oneoff.District.ContainerInstances {
+	for _, ci := range district.ContainerInstances {
 		if ci.ContainerInstanceArn == oneoff.ContainerInstanceARN {
 			matchedCI = ci
 			break
 		}
 	}
+	if matchedCI == nil {
+		return cli.NewExitError(fmt.Sprintf("Could not find the container instance of oneoff %d", oneoff.ID), 1)
+	}
 
-	ssh := utils.NewSshCommand(
-		matchedCI.PrivateIPAddress,
-		oneoff.District.BastionIP,
-		certificate,
-		config.Get(),
-		&utils.CommandRunner{},
-	)
+	lastPath := lastOneoffPath()
+	err := saveLastOneoff(lastPath, &lastOneoff{
+		ID:       oneoff.ID,
+		Heritage: heritageName,
+		District: district.Name,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save the oneoff ID: %s\n", err)
+	}
 
-	if ssh.Run(oneoff.InteractiveRunCommand) != nil && err != nil {
-		return err
+	command := oneoff.InteractiveRunCommand
+	if !opts.TTY {
+		command, err = operations.OneoffExecCommand(oneoff)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+	}
+	sign := func() (*utils.DistrictCertificate, error) {
+		return operations.SignPublicKey(api.DefaultClient, district.Name)
+	}
+	err = utils.NewCertCache(config.Get()).Connect(district.Name, sign, func(cert *utils.DistrictCertificate) error {
+		ssh := utils.NewSshCommandWithOptions(
+			matchedCI.PrivateIPAddress,
+			cert,
+			config.Get(),
+			&utils.CommandRunner{},
+			opts,
+		)
+		return ssh.Run(command)
+	})
+	if err == nil {
+		clearLastOneoff(lastPath)
+		return nil
+	}
+	if code, ok := utils.ExitCode(err); ok && code != utils.SshErrorStatus {
+		clearLastOneoff(lastPath)
+		return cli.NewExitError("", code)
+	}
+	if _, ok := err.(*utils.SessionLostError); !ok {
+		// Connecting, authentication or the host key check failed. The
+		// system ssh binary reports a dropped session the same way, so
+		// the oneoff is kept for reattaching
+		fmt.Fprintf(os.Stderr, "Oneoff %d may still be running. Run `bcn oneoff attach --last` to connect again or `bcn oneoff stop %d` to stop it\n", oneoff.ID, oneoff.ID)
+		return cli.NewExitError(err.Error(), 1)
 	}
 
-	return nil
+	// ssh could not tell us how the command ended, so ask Barcelona
+	fmt.Fprintf(os.Stderr, "Lost the connection to the process: %s\n", err)
+	fmt.Fprintf(os.Stderr, "Waiting for it to finish. Run `bcn oneoff attach --last` to reconnect\n")
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	current, err := waiter.WaitForStop(ctx, 0)
+	if err == context.Canceled {
+		return cli.NewExitError(fmt.Sprintf("Interrupted. Oneoff %d is still running", oneoff.ID), 130)
+	}
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	clearLastOneoff(lastPath)
+	return operations.OneoffExitError(current)
 }
 
 func getHeritageName(branchName string) (string, error) {
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/jarcoal/httpmock"
@@ -25,8 +28,20 @@ func TestCheckEnvVars(t *testing.T) {
 	}
 }
 
+func TestCheckEnvVarsLowercaseAndDigits(t *testing.T) {
+	result, err := checkEnvVars([]string{"abc_1=def", "GHI2=a=b"})
+
+	if err != nil {
+		t.Errorf("Expected there to be no error but got: %s", err)
+	}
+
+	if result["abc_1"] != "def" || result["GHI2"] != "a=b" {
+		t.Errorf("Unexpected result: %s", result)
+	}
+}
+
 func TestCheckEnvVarsError(t *testing.T) {
-	result, err := checkEnvVars([]string{"ABCd=def", "GHI=jkl"})
+	result, err := checkEnvVars([]string{"1ABC=def", "GHI=jkl"})
 
 	if err == nil {
 		t.Errorf("Expected to be an error but was nil")
@@ -69,6 +84,55 @@ func TestRunByBranchName(t *testing.T) {
 	app.Run(testArgs)
 }
 
+func TestRunAttachIsACommand(t *testing.T) {
+	app := newTestApp(RunCommand)
+	endpoint := os.Getenv("BARCELONA_ENDPOINT")
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var params map[string]interface{}
+	httpmock.RegisterResponder("POST", endpoint+"/v1/heritages/nginx/oneoffs",
+		func(req *http.Request) (*http.Response, error) {
+			json.NewDecoder(req.Body).Decode(&params)
+			return httpmock.NewStringResponse(200, `{"oneoff":{"id":12,"status":"PENDING"}}`), nil
+		})
+
+	app.Run([]string{"bcn", "run", "-H", "nginx", "-D", "attach", "--last"})
+
+	if params["command"] != "attach --last" {
+		t.Errorf("Expected attach to be run remotely but got %v", params)
+	}
+}
+
+func TestRunAttachAlias(t *testing.T) {
+	globalFlags := []cli.Flag{
+		cli.BoolFlag{Name: "debug, d"},
+		cli.StringFlag{Name: "output, o"},
+	}
+	cases := []struct {
+		args     string
+		expected string
+	}{
+		{"bcn run attach --last", "bcn oneoff attach --last"},
+		{"bcn -d -o json run attach 12 -e production", "bcn -d -o json oneoff attach 12 -e production"},
+		{"bcn --output=json run attach 12", "bcn --output=json oneoff attach 12"},
+		// A remote command named attach
+		{"bcn run -- attach", "bcn run -- attach"},
+		{"bcn run -e production attach", "bcn run -e production attach"},
+		// run as the value of a flag isn't the command
+		{"bcn -o run attach", "bcn -o run attach"},
+		{"bcn ssh run attach", "bcn ssh run attach"},
+		{"bcn run", "bcn run"},
+	}
+	for _, c := range cases {
+		actual := strings.Join(RunAttachAlias(strings.Fields(c.args), globalFlags), " ")
+		if actual != c.expected {
+			t.Errorf("Expected %q to become %q but got %q", c.args, c.expected, actual)
+		}
+	}
+}
+
 func TestWrongFlag(t *testing.T) {
 	app := newTestApp(RunCommand)
 
@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
 
 	"github.com/degica/barcelona-cli/api"
 	"github.com/urfave/cli"
 )
 
+type secretResult struct {
+	Name     string `json:"name"`
+	District string `json:"district"`
+}
+
 var SecretCommand = cli.Command{
 	Name:  "secret",
 	Usage: "Secret operations",
@@ -51,8 +57,10 @@ var SecretCommand = cli.Command{
 					return err
 				}
 
-				fmt.Println("success to set " + parameterName)
-				return nil
+				result := secretResult{Name: parameterName, District: district}
+				return render(result, func(w io.Writer) {
+					fmt.Fprintln(w, "success to set "+parameterName)
+				})
 			},
 		},
 		{
@@ -77,8 +85,14 @@ var SecretCommand = cli.Command{
 					return err
 				}
 
-				fmt.Println(string(resp))
-				return nil
+				var dResp api.SsmParametersDeleteResponse
+				err = json.Unmarshal(resp, &dResp)
+				if err != nil {
+					return err
+				}
+				return render(dResp, func(w io.Writer) {
+					fmt.Fprintln(w, string(resp))
+				})
 			},
 		},
 	},
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/urfave/cli"
+)
+
+var SshConfigCommand = cli.Command{
+	Name:      "ssh-config",
+	Usage:     "Print an OpenSSH config for the district's bastion and container instances",
+	ArgsUsage: "DISTRICT_NAME",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "write",
+			Usage: "Update the district's hosts in ~/.bcn/ssh_config instead of printing them. Include that file from ~/.ssh/config",
+		},
+		cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "Only sign a new certificate for the district when it has expired. Combine with --write to update the hosts too",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		oper := operations.NewSshConfigOperation(
+			api.DefaultClient,
+			c.Args().Get(0),
+			c.Bool("write"),
+			c.Bool("refresh"),
+			config.Get(),
+		)
+		return operations.Execute(oper)
+	},
+}
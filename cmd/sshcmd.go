@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/degica/barcelona-cli/api"
 	"github.com/degica/barcelona-cli/config"
 	"github.com/degica/barcelona-cli/operations"
@@ -10,18 +12,90 @@ import (
 
 var SSHCommand = cli.Command{
 	Name:      "ssh",
-	Usage:     "SSH into Barcelona container instance",
-	ArgsUsage: "DISTRICT_NAME CONTAINER_INSTANCE_PRIVATE_IP",
+	Usage:     "SSH into Barcelona container instance. Without one the district's instances are listed to pick from",
+	ArgsUsage: "DISTRICT_NAME [PRIVATE_IP|EC2_INSTANCE_ID|CONTAINER_INSTANCE_ARN] | DISTRICT_NAME --all -- COMMAND",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "random",
+			Usage: "Connect to a random active container instance",
+		},
+		cli.BoolFlag{
+			Name:  "least-loaded",
+			Usage: "Connect to the active container instance with the fewest tasks",
+		},
+		cli.BoolFlag{
+			Name:  "all",
+			Usage: "Run COMMAND on every container instance of the district and summarize the exit codes",
+		},
+		cli.StringFlag{
+			Name:  "status",
+			Usage: "Only run on container instances with this status, e.g. ACTIVE, with --all",
+		},
+		cli.StringSliceFlag{
+			Name:  "instance",
+			Usage: "Only run on this container instance with --all. Can be given more than once",
+		},
+		cli.IntFlag{
+			Name:  "concurrency",
+			Value: 10,
+			Usage: "Number of container instances the command runs on at the same time with --all",
+		},
+	},
 	Action: func(c *cli.Context) error {
 		districtName := c.Args().Get(0)
-		ip := c.Args().Get(1)
+
+		if c.Bool("all") {
+			if c.Bool("random") || c.Bool("least-loaded") {
+				return cli.NewExitError("--random and --least-loaded can't be used with --all", 1)
+			}
+			oper := operations.NewSshAllOperation(
+				api.DefaultClient,
+				districtName,
+				sshAllCommand(c.Args().Tail()),
+				operations.SshAllFilter{
+					Status:    c.String("status"),
+					Instances: c.StringSlice("instance"),
+				},
+				c.Int("concurrency"),
+				config.Get(),
+				&utils.CommandRunner{},
+				operations.NoticeWriter(),
+			)
+			return operations.Execute(oper)
+		}
+
+		target := c.Args().Get(1)
+
+		choice := operations.PickInstance
+		switch {
+		case c.Bool("random") && c.Bool("least-loaded"):
+			return cli.NewExitError("--random and --least-loaded can't be used together", 1)
+		case (c.Bool("random") || c.Bool("least-loaded")) && len(target) > 0:
+			return cli.NewExitError("--random and --least-loaded can't be used with an instance", 1)
+		case c.Bool("random"):
+			choice = operations.RandomInstance
+		case c.Bool("least-loaded"):
+			choice = operations.LeastLoadedInstance
+		}
+
 		oper := operations.NewSshcmdOperation(
 			api.DefaultClient,
 			districtName,
-			ip,
+			target,
+			choice,
 			config.Get(),
 			&utils.CommandRunner{},
+			utils.NewStdinInputReader(),
 		)
 		return operations.Execute(oper)
 	},
 }
+
+// The command follows the district. A leading -- only separates it from
+// bcn's own flags
+func sshAllCommand(args []string) string {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	return strings.Join(args, " ")
+}
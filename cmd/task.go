@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+type taskListItem struct {
+	Name string `json:"name"`
+	*api.Task
+}
+
+var TaskCommand = cli.Command{
+	Name:  "task",
+	Usage: "Run named tasks defined in barcelona.yml",
+	Subcommands: []cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the tasks of an environment",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				varFlag,
+			},
+			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				env, err := LoadEnvironment(c.String("environment"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				return printTasks(env.Tasks)
+			},
+		},
+		{
+			Name:      "run",
+			Usage:     "Run a task",
+			ArgsUsage: "NAME [-- ARGS...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "environment, e",
+					Usage: "Environment of heritage",
+				},
+				cli.BoolFlag{
+					Name:  "detach, D",
+					Usage: "Detach mode",
+				},
+				cli.StringSliceFlag{
+					Name:  "envvar, E",
+					Usage: "Environment variable to pass to task. Overrides --env-file, the task's env_vars and run_env.vars in barcelona.yml",
+				},
+				cli.StringSliceFlag{
+					Name:  "env-file",
+					Usage: "Dotenv file with environment variables to pass to task. Overrides the task's env_vars and run_env.vars in barcelona.yml",
+				},
+				cli.BoolFlag{
+					Name:  "no-confirmation",
+					Usage: "Do not ask before running tasks marked with confirm",
+				},
+				cli.DurationFlag{
+					Name:  "start-timeout",
+					Value: 10 * time.Minute,
+					Usage: "Maximum time to wait for the task to start. The task is stopped when it runs out. 0 waits forever",
+				},
+				cli.BoolFlag{
+					Name:  "no-tty",
+					Usage: "Run without a terminal, e.g. in CI. Turned on when stdout is not a terminal",
+				},
+				varFlag,
+			},
+			Action: func(c *cli.Context) error {
+				err := setHeritageConfigVars(c.StringSlice("var"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				name := c.Args().First()
+				if len(name) == 0 {
+					return cli.NewExitError("Task name is required", 1)
+				}
+
+				env, err := LoadEnvironment(c.String("environment"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				task := env.Tasks[name]
+				if task == nil {
+					return cli.NewExitError(fmt.Sprintf("Task %s is not defined in %s", name, c.String("environment")), 1)
+				}
+
+				// run_env.vars < task env_vars < --env-file < -E
+				envVarMap := map[string]string{}
+				if env.RunEnv != nil {
+					for k, v := range env.RunEnv.Vars {
+						envVarMap[k] = v
+					}
+				}
+				for k, v := range task.EnvVars {
+					envVarMap[k] = v
+				}
+				err = mergeEnvVars(envVarMap, c.StringSlice("env-file"), c.StringSlice("envvar"))
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+
+				command := taskCommand(task, c.Args().Tail())
+				if task.Confirm && !c.Bool("no-confirmation") {
+					fmt.Fprintf(operations.NoticeWriter(), "You are about to run %s (%s) on %s\n", name, command, env.Name)
+					if !utils.AreYouSure("Are you sure?", utils.NewStdinInputReader()) {
+						return cli.NewExitError("Aborted", 1)
+					}
+				}
+
+				detach := c.Bool("detach")
+				params := oneoffParams(command, envVarMap, task.Memory, task.User, detach)
+
+				err = connectToHeritage(params, env.Name, detach, sshOptions(c), c.Duration("start-timeout"))
+				if _, ok := err.(cli.ExitCoder); ok {
+					return err
+				}
+				if err != nil {
+					return cli.NewExitError(err.Error(), 1)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+// Appends the arguments given after the task name. A leading -- is
+// only there to separate them from bcn's own flags
+func taskCommand(task *api.Task, extra []string) string {
+	if len(extra) > 0 && extra[0] == "--" {
+		extra = extra[1:]
+	}
+	if len(extra) == 0 {
+		return task.Command
+	}
+	return task.Command + " " + strings.Join(extra, " ")
+}
+
+func printTasks(tasks map[string]*api.Task) error {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]taskListItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, taskListItem{Name: name, Task: tasks[name]})
+	}
+
+	return render(items, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Name", "Description", "Command"})
+		table.SetBorder(false)
+		for _, item := range items {
+			table.Append([]string{item.Name, item.Description, item.Command})
+		}
+		table.Render()
+	})
+}
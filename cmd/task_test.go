@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+func TestTaskCommand(t *testing.T) {
+	task := &api.Task{Command: "rake backfill"}
+
+	cases := map[string][]string{
+		"rake backfill":           nil,
+		"rake backfill 2020 2021": {"2020", "2021"},
+		"rake backfill --dry-run": {"--", "--dry-run"},
+	}
+	for expected, extra := range cases {
+		if command := taskCommand(task, extra); command != expected {
+			t.Errorf("Expected %q but got %q", expected, command)
+		}
+	}
+}
+
+func TestParseHeritageConfigTasks(t *testing.T) {
+	data := []byte(`environments:
+  staging:
+    name: app-staging
+    image_name: app
+    tasks:
+      migrate:
+        description: Run migrations
+        command: rake db:migrate
+        memory: 1024
+        env_vars:
+          VERBOSE: "1"
+  production:
+    extends: staging
+    name: app
+    tasks:
+      migrate:
+        confirm: true
+      console:
+        command: rails console
+        user: app
+`)
+
+	config, err := parseHeritageConfig(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tasks := config.Environments["production"].Tasks
+	migrate := tasks["migrate"]
+	if migrate == nil || migrate.Command != "rake db:migrate" || migrate.Memory != 1024 || !migrate.Confirm || migrate.EnvVars["VERBOSE"] != "1" {
+		t.Errorf("Unexpected migrate task %+v", migrate)
+	}
+	if tasks["console"] == nil || tasks["console"].User != "app" {
+		t.Errorf("Unexpected console task %+v", tasks["console"])
+	}
+	if config.Environments["staging"].Tasks["migrate"].Confirm {
+		t.Errorf("Expected staging's migrate task to stay unconfirmed")
+	}
+}
+
+func TestValidateHeritageConfigTasks(t *testing.T) {
+	data := []byte(`environments:
+  production:
+    name: app
+    image_name: app
+    tasks:
+      migrate:
+        description: Run migrations
+        memroy: 1024
+`)
+
+	diags := validateHeritageConfig(data)
+	expected := []string{
+		`7:9: task has no command`,
+		`8:9: unknown key "memroy"`,
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, diags)
+	}
+	for i, d := range diags {
+		if d.String() != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], d)
+		}
+	}
+}
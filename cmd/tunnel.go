@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/operations"
+	"github.com/urfave/cli"
+)
+
+var TunnelCommand = cli.Command{
+	Name:      "tunnel",
+	Usage:     "Forward a local port to an address inside the district's VPC through the bastion",
+	ArgsUsage: "DISTRICT_NAME",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "local, l",
+			Usage: "Local port to listen on, or ADDRESS:PORT to listen on another interface than 127.0.0.1",
+		},
+		cli.StringFlag{
+			Name:  "remote, r",
+			Usage: "HOST:PORT to connect to from the bastion",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		oper := operations.NewTunnelOperation(
+			api.DefaultClient,
+			c.Args().Get(0),
+			c.String("local"),
+			c.String("remote"),
+			config.Get(),
+			operations.NoticeWriter(),
+		)
+		return operations.Execute(oper)
+	},
+}
@@ -3,17 +3,62 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
+	"github.com/urfave/cli"
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/operations"
 )
 
+const HeritageConfigFileName = "barcelona.yml"
+
 var HeritageConfigFilePath string
 
-func PrintOneoff(o *api.Oneoff) {
-	fmt.Printf("Task ARN: %s\n", o.TaskARN)
+// FindHeritageConfig looks for barcelona.yml in dir and then in its
+// parents, stopping at the git root or the filesystem root. When none is
+// found the path in dir is returned so errors name the expected file
+func FindHeritageConfig(dir string) string {
+	current := dir
+	for {
+		path := filepath.Join(current, HeritageConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			break
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			break
+		}
+		current = parent
+	}
+
+	return filepath.Join(dir, HeritageConfigFileName)
+}
+
+func PrintOneoff(o *api.Oneoff) error {
+	return render(o, o.Fprint)
+}
+
+func printHeritage(h *api.Heritage) error {
+	return render(h, h.Fprint)
+}
+
+// operations.Render for commands. The error makes bcn exit with 1
+func render(v interface{}, human func(w io.Writer)) error {
+	err := operations.Render(v, human)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
 }
 
 type HeritageConfig struct {
@@ -22,13 +67,36 @@ type HeritageConfig struct {
 }
 
 func loadHeritageConfig() (*HeritageConfig, error) {
-	configFile, err := ioutil.ReadFile(HeritageConfigFilePath)
+	return loadHeritageConfigFile(HeritageConfigFilePath)
+}
+
+func loadHeritageConfigFile(path string) (*HeritageConfig, error) {
+	configFile, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
+	configFile, err = interpolateHeritageConfig(configFile, HeritageConfigVars)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	config, err := parseHeritageConfig(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return config, nil
+}
+
+func parseHeritageConfig(data []byte) (*HeritageConfig, error) {
 	var config HeritageConfig
-	err = yaml.Unmarshal(configFile, &config)
+	err := yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resolveExtends(data, &config)
 	if err != nil {
 		return nil, err
 	}
@@ -37,13 +105,17 @@ func loadHeritageConfig() (*HeritageConfig, error) {
 }
 
 func LoadEnvironment(env string) (*api.Heritage, error) {
-	config, err := loadHeritageConfig()
+	return loadEnvironmentFile(HeritageConfigFilePath, env)
+}
+
+func loadEnvironmentFile(path string, env string) (*api.Heritage, error) {
+	config, err := loadHeritageConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
 	heritage := config.Environments[env]
 	if heritage == nil {
-		return nil, errors.New("environment is invalid")
+		return nil, fmt.Errorf("environment is invalid: %q is not defined in %s", env, path)
 	}
 	return heritage, nil
 }
@@ -55,7 +127,23 @@ func LoadReviewDefinition() (*api.ReviewAppDefinition, error) {
 	}
 	review := config.Review
 	if review == nil {
-		return nil, errors.New("reviewapp is invalid")
+		return nil, fmt.Errorf("reviewapp is invalid: no review section in %s", HeritageConfigFilePath)
 	}
 	return review, nil
 }
+
+// Returns the heritage name given either an environment in barcelona.yml
+// or an explicit heritage name
+func resolveHeritageName(envName, heritageName string) (string, error) {
+	if len(envName) > 0 && len(heritageName) > 0 {
+		return "", errors.New("environment and heritage-name are exclusive")
+	}
+	if len(heritageName) > 0 {
+		return heritageName, nil
+	}
+	env, err := LoadEnvironment(envName)
+	if err != nil {
+		return "", err
+	}
+	return env.Name, nil
+}
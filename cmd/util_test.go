@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindHeritageConfig(t *testing.T) {
+	outside := t.TempDir()
+	root := filepath.Join(outside, "project")
+	nested := filepath.Join(root, "services", "web", "app")
+	os.MkdirAll(nested, 0755)
+	os.MkdirAll(filepath.Join(root, ".git"), 0755)
+
+	// Outside of the git root, must not be found
+	ioutil.WriteFile(filepath.Join(outside, HeritageConfigFileName), []byte(""), 0644)
+
+	expected := filepath.Join(nested, HeritageConfigFileName)
+	if path := FindHeritageConfig(nested); path != expected {
+		t.Errorf("Expected %s but got %s", expected, path)
+	}
+
+	ioutil.WriteFile(filepath.Join(root, "services", HeritageConfigFileName), []byte(""), 0644)
+
+	expected = filepath.Join(root, "services", HeritageConfigFileName)
+	if path := FindHeritageConfig(nested); path != expected {
+		t.Errorf("Expected %s but got %s", expected, path)
+	}
+}
+
+func TestLoadEnvironmentNamesFile(t *testing.T) {
+	pwd, _ := os.Getwd()
+	HeritageConfigFilePath = pwd + "/test/test-barcelona.yml"
+
+	_, err := LoadEnvironment("nothing")
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	expected := `environment is invalid: "nothing" is not defined in ` + HeritageConfigFilePath
+	if err.Error() != expected {
+		t.Errorf("Expected %s but got %s", expected, err)
+	}
+}
@@ -0,0 +1,452 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/urfave/cli"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	minServiceCpu    = 0
+	maxServiceCpu    = 10240
+	minServiceMemory = 16
+	maxServiceMemory = 122880
+)
+
+var supportedRuleConditionTypes = []string{"path-pattern", "host-header"}
+
+var ValidateCommand = cli.Command{
+	Name:  "validate",
+	Usage: "Check barcelona.yml for mistakes without contacting Barcelona",
+	Flags: []cli.Flag{
+		varFlag,
+	},
+	Action: func(c *cli.Context) error {
+		err := setHeritageConfigVars(c.StringSlice("var"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		data, err := ioutil.ReadFile(HeritageConfigFilePath)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		var diags []configDiagnostic
+		data, err = interpolateHeritageConfig(data, HeritageConfigVars)
+		if ierr, ok := err.(interpolationError); ok {
+			diags = []configDiagnostic{{Line: ierr.Line, Message: fmt.Sprintf("variable %s is not defined and has no default", ierr.Name)}}
+		} else {
+			diags = validateHeritageConfig(data)
+		}
+		result := validateResult{
+			File:     HeritageConfigFilePath,
+			Valid:    len(diags) == 0,
+			Problems: diags,
+		}
+		err = render(result, func(w io.Writer) {
+			for _, d := range diags {
+				fmt.Fprintf(w, "%s:%s\n", HeritageConfigFilePath, d)
+			}
+			if len(diags) == 0 {
+				fmt.Fprintf(w, "%s is valid\n", HeritageConfigFilePath)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if len(diags) > 0 {
+			return cli.NewExitError(fmt.Sprintf("%d problem(s) found", len(diags)), 1)
+		}
+
+		return nil
+	},
+}
+
+type configDiagnostic struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+type validateResult struct {
+	File     string             `json:"file"`
+	Valid    bool               `json:"valid"`
+	Problems []configDiagnostic `json:"problems"`
+}
+
+func (d configDiagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+}
+
+type configValidator struct {
+	diags []configDiagnostic
+}
+
+func (v *configValidator) report(n *yamlv3.Node, format string, args ...interface{}) {
+	v.diags = append(v.diags, configDiagnostic{
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+type configField struct {
+	key   *yamlv3.Node
+	value *yamlv3.Node
+}
+
+// validateHeritageConfig checks the contents of a barcelona.yml and
+// returns every problem found, ordered by position in the file
+func validateHeritageConfig(data []byte) []configDiagnostic {
+	v := &configValidator{}
+
+	var doc yamlv3.Node
+	err := yamlv3.Unmarshal(data, &doc)
+	if err != nil {
+		return yamlErrorDiagnostics(err)
+	}
+	if len(doc.Content) == 0 {
+		return []configDiagnostic{{Message: "file is empty"}}
+	}
+
+	// Catch values the client itself would fail to decode
+	_, err = parseHeritageConfig(data)
+	if err != nil {
+		v.diags = append(v.diags, yamlErrorDiagnostics(err)...)
+	}
+
+	root := resolveNode(doc.Content[0])
+	if root.Kind != yamlv3.MappingNode {
+		v.report(root, "expected a mapping at the top level")
+		return v.diags
+	}
+
+	known := yamlKeys(reflect.TypeOf(HeritageConfig{}))
+	for _, f := range mappingFields(root) {
+		t, ok := known[f.key.Value]
+		if !ok {
+			// Top level keys are commonly used to hold anchors
+			if f.value.Anchor == "" {
+				v.report(f.key, "unknown key %q", f.key.Value)
+			}
+			continue
+		}
+		v.walk(f.value, t)
+	}
+
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		if v.diags[i].Line != v.diags[j].Line {
+			return v.diags[i].Line < v.diags[j].Line
+		}
+		return v.diags[i].Column < v.diags[j].Column
+	})
+
+	return v.diags
+}
+
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// YAML errors carry their position as "line N: message", one per line
+// when decoding failed on several values
+func yamlErrorDiagnostics(err error) []configDiagnostic {
+	var diags []configDiagnostic
+	for _, line := range strings.Split(err.Error(), "\n") {
+		m := yamlErrorLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		diags = append(diags, configDiagnostic{Line: n, Message: m[2]})
+	}
+	if len(diags) == 0 {
+		diags = []configDiagnostic{{Message: err.Error()}}
+	}
+	return diags
+}
+
+func resolveNode(n *yamlv3.Node) *yamlv3.Node {
+	for n.Kind == yamlv3.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+// Returns the key value pairs of a mapping with merge keys (<<) expanded
+func mappingFields(n *yamlv3.Node) []configField {
+	var merged []configField
+	var explicit []configField
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		value := n.Content[i+1]
+		if key.Value != "<<" {
+			explicit = append(explicit, configField{key, value})
+			continue
+		}
+
+		value = resolveNode(value)
+		sources := []*yamlv3.Node{value}
+		if value.Kind == yamlv3.SequenceNode {
+			sources = value.Content
+		}
+		for _, src := range sources {
+			src = resolveNode(src)
+			if src.Kind == yamlv3.MappingNode {
+				merged = append(merged, mappingFields(src)...)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, f := range explicit {
+		seen[f.key.Value] = true
+	}
+	fields := explicit
+	for _, f := range merged {
+		if !seen[f.key.Value] {
+			seen[f.key.Value] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Returns the YAML keys a struct accepts mapped to their types. Fields
+// without a yaml tag, like the counts Barcelona reports on services,
+// don't belong in barcelona.yml even though the decoder would fill them
+func yamlKeys(t reflect.Type) map[string]reflect.Type {
+	keys := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || name == "" {
+			continue
+		}
+		keys[name] = field.Type
+	}
+	return keys
+}
+
+func (v *configValidator) walk(n *yamlv3.Node, t reflect.Type) {
+	n = resolveNode(n)
+	if n.Kind == yamlv3.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(api.EnvironmentVariableSet{}) {
+		v.checkEnvironment(n)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yamlv3.MappingNode {
+			v.report(n, "expected a mapping")
+			return
+		}
+		known := yamlKeys(t)
+		fields := map[string]configField{}
+		for _, f := range mappingFields(n) {
+			ft, ok := known[f.key.Value]
+			if !ok {
+				v.report(f.key, "unknown key %q", f.key.Value)
+				continue
+			}
+			fields[f.key.Value] = f
+			v.walk(f.value, ft)
+		}
+		v.checkStruct(n, t, fields)
+	case reflect.Slice:
+		if n.Kind != yamlv3.SequenceNode {
+			v.report(n, "expected a list")
+			return
+		}
+		for _, item := range n.Content {
+			v.walk(item, t.Elem())
+		}
+	case reflect.Map:
+		if n.Kind != yamlv3.MappingNode {
+			v.report(n, "expected a mapping")
+			return
+		}
+		for _, f := range mappingFields(n) {
+			v.walk(f.value, t.Elem())
+		}
+	}
+}
+
+func (v *configValidator) checkStruct(n *yamlv3.Node, t reflect.Type, fields map[string]configField) {
+	switch t {
+	case reflect.TypeOf(api.Heritage{}), reflect.TypeOf(api.ReviewAppDefinition{}):
+		v.checkServiceNames(fields["services"].value)
+	case reflect.TypeOf(api.Service{}), reflect.TypeOf(api.ReviewAppService{}):
+		v.checkRange(fields["cpu"].value, "cpu", minServiceCpu, maxServiceCpu)
+		v.checkRange(fields["memory"].value, "memory", minServiceMemory, maxServiceMemory)
+		v.checkLbPorts(fields["port_mappings"].value)
+	case reflect.TypeOf(api.Listener{}):
+		endpoint := fields["endpoint"].value
+		if endpoint == nil || len(resolveNode(endpoint).Value) == 0 {
+			v.report(n, "listener has no endpoint")
+		}
+	case reflect.TypeOf(api.RuleCondition{}):
+		typ := fields["type"].value
+		if typ == nil {
+			v.report(n, "rule condition has no type")
+		} else if !containsString(supportedRuleConditionTypes, resolveNode(typ).Value) {
+			v.report(typ, "unsupported rule condition type %q (expected one of %s)", resolveNode(typ).Value, strings.Join(supportedRuleConditionTypes, ", "))
+		}
+	case reflect.TypeOf(api.Task{}):
+		command := fields["command"].value
+		if command == nil || len(resolveNode(command).Value) == 0 {
+			v.report(n, "task has no command")
+		}
+	case reflect.TypeOf(api.ScheduledTask{}):
+		schedule := fields["schedule"].value
+		if schedule == nil {
+			v.report(n, "scheduled task has no schedule")
+		} else if _, err := utils.ParseSchedule(resolveNode(schedule).Value); err != nil {
+			v.report(schedule, "invalid schedule: %s", err)
+		}
+	}
+}
+
+func (v *configValidator) checkServiceNames(services *yamlv3.Node) {
+	if services == nil {
+		return
+	}
+	services = resolveNode(services)
+	seen := map[string]bool{}
+	for _, s := range services.Content {
+		s = resolveNode(s)
+		if s.Kind != yamlv3.MappingNode {
+			continue
+		}
+		for _, f := range mappingFields(s) {
+			if f.key.Value != "name" {
+				continue
+			}
+			name := resolveNode(f.value).Value
+			if seen[name] {
+				v.report(f.value, "duplicate service name %q", name)
+			}
+			seen[name] = true
+		}
+	}
+}
+
+func (v *configValidator) checkLbPorts(mappings *yamlv3.Node) {
+	if mappings == nil {
+		return
+	}
+	mappings = resolveNode(mappings)
+	seen := map[string]bool{}
+	for _, m := range mappings.Content {
+		m = resolveNode(m)
+		if m.Kind != yamlv3.MappingNode {
+			continue
+		}
+		for _, f := range mappingFields(m) {
+			if f.key.Value != "lb_port" {
+				continue
+			}
+			port := resolveNode(f.value).Value
+			if seen[port] {
+				v.report(f.value, "lb_port %s is used by more than one port mapping", port)
+			}
+			seen[port] = true
+		}
+	}
+}
+
+func (v *configValidator) checkRange(n *yamlv3.Node, name string, min, max int) {
+	if n == nil {
+		return
+	}
+	n = resolveNode(n)
+	value, err := strconv.Atoi(n.Value)
+	if err != nil {
+		v.report(n, "%s must be an integer", name)
+		return
+	}
+	if value < min || value > max {
+		v.report(n, "%s %d is out of range (%d-%d)", name, value, min, max)
+	}
+}
+
+var environmentSources = []string{"value", "value_from", "ssm_path"}
+
+// environment accepts either a list of {name, value|value_from|ssm_path}
+// or a mapping of name to {value|value_from|ssm_path}
+func (v *configValidator) checkEnvironment(n *yamlv3.Node) {
+	switch n.Kind {
+	case yamlv3.SequenceNode:
+		for _, item := range n.Content {
+			item = resolveNode(item)
+			if item.Kind != yamlv3.MappingNode {
+				v.report(item, "expected a mapping")
+				continue
+			}
+			hasName := false
+			for _, f := range mappingFields(item) {
+				if f.key.Value == "name" {
+					hasName = true
+				}
+			}
+			if !hasName {
+				v.report(item, "environment entry has no name")
+			}
+			v.checkEnvironmentEntry(item, "name")
+		}
+	case yamlv3.MappingNode:
+		for _, f := range mappingFields(n) {
+			entry := resolveNode(f.value)
+			if entry.Kind != yamlv3.MappingNode {
+				v.report(entry, "expected a mapping")
+				continue
+			}
+			v.checkEnvironmentEntry(entry)
+		}
+	default:
+		v.report(n, "expected a list or a mapping")
+	}
+}
+
+func (v *configValidator) checkEnvironmentEntry(n *yamlv3.Node, extraKeys ...string) {
+	var sources []string
+	for _, f := range mappingFields(n) {
+		switch {
+		case containsString(environmentSources, f.key.Value):
+			sources = append(sources, f.key.Value)
+		case containsString(extraKeys, f.key.Value):
+		default:
+			v.report(f.key, "unknown key %q", f.key.Value)
+		}
+	}
+	if len(sources) > 1 {
+		v.report(n, "environment entry sets more than one of %s", strings.Join(sources, ", "))
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
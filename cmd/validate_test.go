@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestValidateHeritageConfigValid(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, err := ioutil.ReadFile(pwd + "/test/test-barcelona.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := validateHeritageConfig(data)
+	if len(diags) != 0 {
+		t.Errorf("Expected no problems but got %v", diags)
+	}
+}
+
+func TestValidateHeritageConfig(t *testing.T) {
+	data := []byte(`environments:
+  production:
+    name: app
+    image_name: app
+    unknown_key: 1
+    scheduled_tasks:
+      - schedule: cron(0 12 * * * *)
+        command: rake report
+      - schedule: rate(5 minutes)
+        command: rake sync
+    environment:
+      - name: FOO
+        value: bar
+        ssm_path: /foo
+    services:
+      - name: web
+        memory: 100000000
+        port_mappings:
+          - lb_port: 80
+            container_port: 3000
+          - lb_port: 80
+            container_port: 3001
+        listeners:
+          - health_check_path: /
+            rule_conditions:
+              - type: query-string
+                value: a=b
+      - name: web
+        cpu: -1
+`)
+
+	expected := []string{
+		"5:5: unknown key \"unknown_key\"",
+		"7:19: invalid schedule: exactly one of day-of-month and day-of-week must be ? in \"cron(0 12 * * * *)\"",
+		"12:9: environment entry sets more than one of value, ssm_path",
+		"17:17: memory 100000000 is out of range (16-122880)",
+		"21:22: lb_port 80 is used by more than one port mapping",
+		"24:13: listener has no endpoint",
+		"26:23: unsupported rule condition type \"query-string\" (expected one of path-pattern, host-header)",
+		"28:15: duplicate service name \"web\"",
+		"29:14: cpu -1 is out of range (0-10240)",
+	}
+
+	diags := validateHeritageConfig(data)
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d problems but got %v", len(expected), diags)
+	}
+	for i, d := range diags {
+		if d.String() != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], d.String())
+		}
+	}
+}
+
+func TestValidateHeritageConfigErrorLines(t *testing.T) {
+	data := []byte(`environments:
+  production:
+    name: app
+    services:
+      - name: web
+        memory: lots
+        status: ACTIVE
+`)
+
+	expected := []string{
+		"6:0: cannot unmarshal !!str `lots` into int",
+		"6:17: memory must be an integer",
+		"7:9: unknown key \"status\"",
+	}
+
+	diags := validateHeritageConfig(data)
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d problems but got %v", len(expected), diags)
+	}
+	for i, d := range diags {
+		if d.String() != expected[i] {
+			t.Errorf("Expected %s but got %s", expected[i], d.String())
+		}
+	}
+
+	diags = validateHeritageConfig([]byte("environments:\n  production:\n    name: [app\n"))
+	if len(diags) != 1 || diags[0].Line == 0 {
+		t.Errorf("Expected the syntax error to have a line but got %v", diags)
+	}
+}
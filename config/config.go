@@ -11,6 +11,15 @@ import (
 
 var Debug bool
 
+// Output format chosen with the global --output flag
+var Output string
+
+// Use the built in SSH client instead of the ssh binary
+var NativeSsh bool
+
+// Replace pinned host keys that changed instead of refusing to connect
+var AcceptChangedHostKey bool
+
 // Clients should get configs using this function
 func Get() *LocalConfig {
 	path, err := getConfigPath()
@@ -23,6 +32,8 @@ func Get() *LocalConfig {
 		privateKeyPath: filepath.Join(path, "id_ecdsa"),
 		publicKeyPath:  filepath.Join(path, "id_ecdsa.pub"),
 		certPath:       filepath.Join(path, "id_ecdsa-cert.pub"),
+		sshConfigPath:  filepath.Join(path, "ssh_config"),
+		knownHostsPath: filepath.Join(path, "known_hosts"),
 	}
 }
 
@@ -33,6 +44,8 @@ type LocalConfig struct {
 	privateKeyPath string
 	publicKeyPath  string
 	certPath       string
+	sshConfigPath  string
+	knownHostsPath string
 }
 
 func (m LocalConfig) GetPrivateKeyPath() string {
@@ -47,6 +60,23 @@ func (m LocalConfig) GetCertPath() string {
 	return m.certPath
 }
 
+// Signed certificates are kept per district so that signing for one
+// district doesn't replace another's. See utils.CertCache
+func (m LocalConfig) GetDistrictCertPath(district string) string {
+	return filepath.Join(m.configDir, "certs", district+"-cert.pub")
+}
+
+// The file ssh-config --write maintains for ~/.ssh/config to Include
+func (m LocalConfig) GetSshConfigPath() string {
+	return m.sshConfigPath
+}
+
+// Host keys pinned and host CAs trusted per district. See
+// utils.KnownHosts
+func (m LocalConfig) GetKnownHostsPath() string {
+	return m.knownHostsPath
+}
+
 func (m LocalConfig) GetConfigDir() string {
 	return m.configDir
 }
@@ -55,6 +85,14 @@ func (m LocalConfig) IsDebug() bool {
 	return Debug
 }
 
+func (m LocalConfig) UseNativeSsh() bool {
+	return NativeSsh
+}
+
+func (m LocalConfig) AcceptChangedHostKey() bool {
+	return AcceptChangedHostKey
+}
+
 func (m LocalConfig) WriteLogin(auth string, token string, endpoint string, vaultUrl string, vaultToken string) error {
 	login := &Login{
 		Auth:       auth,
@@ -9,6 +9,7 @@ require (
 	github.com/urfave/cli v1.19.1
 	golang.org/x/crypto v0.1.0
 	gopkg.in/yaml.v2 v2.0.0-20170208141851-a3f3340b5840
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -8,6 +8,7 @@ import (
 
 	"github.com/degica/barcelona-cli/cmd"
 	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -22,6 +23,29 @@ func main() {
 			Usage:       "Enable debug mode",
 			Destination: &config.Debug,
 		},
+		cli.StringFlag{
+			Name:   "config, c",
+			Usage:  "Path to barcelona.yml. By default it is searched for from the current directory up to the git root",
+			EnvVar: "BCN_CONFIG",
+		},
+		cli.StringFlag{
+			Name:        "output, o",
+			Value:       utils.OutputTable,
+			Usage:       "Output format: table, json or yaml",
+			EnvVar:      "BCN_OUTPUT",
+			Destination: &config.Output,
+		},
+		cli.BoolFlag{
+			Name:        "native-ssh",
+			Usage:       "Use the built in SSH client instead of the ssh command for run and ssh",
+			EnvVar:      "BCN_NATIVE_SSH",
+			Destination: &config.NativeSsh,
+		},
+		cli.BoolFlag{
+			Name:        "accept-changed-host-key",
+			Usage:       "Forget the pinned host keys of the hosts being connected to and pin their new ones. Only use this when you know they were replaced",
+			Destination: &config.AcceptChangedHostKey,
+		},
 	}
 	app.Commands = []cli.Command{
 		cmd.LoginCommand,
@@ -32,13 +56,22 @@ func main() {
 		cmd.APICommand,
 		cmd.EnvCommand,
 		cmd.RunCommand,
+		cmd.OneoffCommand,
+		cmd.TaskCommand,
+		cmd.CronCommand,
 		cmd.SSHCommand,
+		cmd.TunnelCommand,
+		cmd.ProxyCommand,
+		cmd.SshConfigCommand,
+		cmd.CpCommand,
 		cmd.ReleaseCommand,
 		cmd.NotificationCommand,
 		cmd.AppCommand,
 		cmd.ReviewCommand,
 		cmd.ProfileCommand,
 		cmd.SecretCommand,
+		cmd.ValidateCommand,
+		cmd.ConfigCommand,
 	}
 
 	pwd, err := os.Getwd()
@@ -47,7 +80,19 @@ func main() {
 		os.Exit(1)
 	}
 
-	cmd.HeritageConfigFilePath = pwd + "/barcelona.yml"
+	app.Before = func(c *cli.Context) error {
+		err := utils.ValidateOutputFormat(config.Output)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		path := c.GlobalString("config")
+		if len(path) == 0 {
+			path = cmd.FindHeritageConfig(pwd)
+		}
+		cmd.HeritageConfigFilePath = path
+		return nil
+	}
 
-	app.Run(os.Args)
+	app.Run(cmd.RunAttachAlias(os.Args, app.Flags))
 }
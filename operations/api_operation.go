@@ -2,6 +2,7 @@ package operations
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -41,7 +42,17 @@ func (apiOperation ApiOperation) run() *runResult {
 		return error_result(err.Error())
 	}
 
-	fmt.Println(utils.PrettyJSON(response))
+	var v interface{}
+	human := func(w io.Writer) {
+		fmt.Fprintln(w, utils.PrettyJSON(response))
+	}
+	// A body that isn't JSON, like the empty one of a 204, is shown as is
+	if json.Unmarshal(response, &v) != nil {
+		v = string(response)
+		human = func(w io.Writer) {
+			fmt.Fprintln(w, v)
+		}
+	}
 
-	return ok_result()
+	return render(v, human)
 }
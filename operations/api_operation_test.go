@@ -64,3 +64,18 @@ func ExampleApiOperation_run_with_error_output() {
 	oper.run()
 	// Output:
 }
+
+type MockTextApiOperationApiClient struct{}
+
+func (client MockTextApiOperationApiClient) Request(method string, path string, body io.Reader) ([]byte, error) {
+	return bytes.NewBufferString("pong").Bytes(), nil
+}
+
+func ExampleApiOperation_run_text_output() {
+	client := &MockTextApiOperationApiClient{}
+	oper := NewApiOperation("GET", "https://somewhere", bytes.NewBufferString(""), client)
+
+	oper.run()
+	// Output:
+	// pong
+}
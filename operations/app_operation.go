@@ -34,7 +34,7 @@ func NewAppOperation(name string, op_type OperationType, no_confirm bool, client
 }
 
 func app_delete(operation AppOperation) *runResult {
-	fmt.Printf("You are attempting to delete %s\n", operation.name)
+	fmt.Fprintf(NoticeWriter(), "You are attempting to delete %s\n", operation.name)
 	if !operation.no_confirm && !utils.AreYouSure("This operation cannot be undone. Are you sure?", operation.input_reader) {
 		return nil
 	}
@@ -43,7 +43,7 @@ func app_delete(operation AppOperation) *runResult {
 	if err != nil {
 		return error_result(err.Error())
 	}
-	fmt.Printf("Deleted %s\n", operation.name)
+	fmt.Fprintf(NoticeWriter(), "Deleted %s\n", operation.name)
 
 	return ok_result()
 }
@@ -61,9 +61,7 @@ func app_show(operation AppOperation) *runResult {
 	if hResp.Heritage == nil {
 		return error_result("No such heritage")
 	}
-	hResp.Heritage.Print()
-
-	return ok_result()
+	return render(hResp.Heritage, hResp.Heritage.Fprint)
 }
 
 func (operation AppOperation) run() *runResult {
@@ -0,0 +1,459 @@
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+)
+
+// How often the progress line is updated
+var cpProgressInterval = 500 * time.Millisecond
+
+type CpOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
+	Post(path string, body io.Reader) ([]byte, error)
+}
+
+// One side of a copy. Local specs only have Path
+type CpSpec struct {
+	District string
+	// Private IP or EC2 instance ID
+	Host string
+	// Zero unless the path is in a oneoff's container
+	OneoffID int
+	Path     string
+}
+
+func (s CpSpec) IsRemote() bool {
+	return len(s.District) > 0 || s.OneoffID > 0
+}
+
+func (s CpSpec) String() string {
+	switch {
+	case s.OneoffID > 0:
+		return fmt.Sprintf("%d:%s", s.OneoffID, s.Path)
+	case len(s.District) > 0:
+		return s.District + ":" + s.Host + ":" + s.Path
+	}
+	return s.Path
+}
+
+var oneoffCpSpec = regexp.MustCompile(`^([0-9]+):(.+)$`)
+
+// ParseCpSpec reads DISTRICT:HOST:/path, ONEOFF_ID:/path or a local
+// path. Local paths with colons can be written as ./path
+func ParseCpSpec(arg string) CpSpec {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") || filepath.IsAbs(arg) {
+		return CpSpec{Path: arg}
+	}
+	if m := oneoffCpSpec.FindStringSubmatch(arg); m != nil {
+		id, err := strconv.Atoi(m[1])
+		if err == nil {
+			return CpSpec{OneoffID: id, Path: m[2]}
+		}
+	}
+	parts := strings.SplitN(arg, ":", 3)
+	if len(parts) == 3 && len(parts[0]) > 0 && len(parts[1]) > 0 && len(parts[2]) > 0 {
+		return CpSpec{District: parts[0], Host: parts[1], Path: parts[2]}
+	}
+	return CpSpec{Path: arg}
+}
+
+type CpOperation struct {
+	client    CpOperationApiClient
+	src       CpSpec
+	dst       CpSpec
+	recursive bool
+	sudo      bool
+	progress  bool
+	// Heritage of a oneoff spec and its district, which may be empty
+	heritageName  string
+	districtName  string
+	config        utils.SshConfig
+	commandRunner utils.SshCommandRunner
+	// Progress and warnings go here
+	out io.Writer
+}
+
+type cpResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Files       int    `json:"files"`
+	// Size of the tar stream, which is a bit more than the files
+	Bytes int64 `json:"bytes"`
+	// False when the remote side has no sha256sum
+	Verified bool `json:"verified"`
+}
+
+func NewCpOperation(
+	client CpOperationApiClient,
+	src CpSpec,
+	dst CpSpec,
+	recursive bool,
+	sudo bool,
+	progress bool,
+	heritageName string,
+	districtName string,
+	config utils.SshConfig,
+	commandRunner utils.SshCommandRunner,
+	out io.Writer) *CpOperation {
+	return &CpOperation{
+		client:        client,
+		src:           src,
+		dst:           dst,
+		recursive:     recursive,
+		sudo:          sudo,
+		progress:      progress,
+		heritageName:  heritageName,
+		districtName:  districtName,
+		config:        config,
+		commandRunner: commandRunner,
+		out:           out,
+	}
+}
+
+// Where a remote spec's commands run
+type cpRemote struct {
+	ip       string
+	district string
+	// Runs a script in the right place with the right user
+	shell func(script string) string
+}
+
+func (oper CpOperation) run() *runResult {
+	if len(oper.src.Path) == 0 || len(oper.dst.Path) == 0 {
+		return error_result("source and destination are required")
+	}
+	if oper.src.IsRemote() == oper.dst.IsRemote() {
+		return error_result("one of source and destination must be remote, e.g. DISTRICT:IP:/path or ONEOFF_ID:/path")
+	}
+
+	spec := oper.src
+	if oper.dst.IsRemote() {
+		spec = oper.dst
+	}
+	remote, err := oper.remote(spec)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	result := cpResult{Source: oper.src.String(), Destination: oper.dst.String()}
+	progress := newCpProgress(oper.out, oper.progress)
+	var local, remoteSums utils.CopyChecksums
+	if oper.src.IsRemote() {
+		local, remoteSums, err = oper.download(remote, progress)
+	} else {
+		local, remoteSums, err = oper.upload(remote, progress)
+	}
+	progress.stop()
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	result.Files = len(local)
+	result.Bytes = progress.bytes()
+	if len(local) > 0 && len(remoteSums) == 0 {
+		fmt.Fprintf(oper.out, "Checksums were not verified since sha256sum is not available on the remote side\n")
+	} else {
+		mismatched := local.Compare(remoteSums)
+		if len(mismatched) > 0 {
+			sort.Strings(mismatched)
+			return error_result(fmt.Sprintf("Checksums don't match for %s", strings.Join(mismatched, ", ")))
+		}
+		result.Verified = true
+	}
+
+	return render(result, func(w io.Writer) {
+		files := "files"
+		if result.Files == 1 {
+			files = "file"
+		}
+		fmt.Fprintf(w, "Copied %d %s from %s to %s (%s transferred)\n", result.Files, files, result.Source, result.Destination, formatBytes(result.Bytes))
+		if result.Verified {
+			fmt.Fprintf(w, "Checksums verified\n")
+		}
+	})
+}
+
+func (oper CpOperation) download(remote *cpRemote, progress *cpProgress) (utils.CopyChecksums, utils.CopyChecksums, error) {
+	dir, name, err := remotePathParts(oper.src.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	check := fmt.Sprintf(`[ -e %s ] || { echo "%s: No such file or directory" >&2; exit 1; }`, shellQuote(oper.src.Path), oper.src.Path)
+	if !oper.recursive {
+		check += fmt.Sprintf(`; [ ! -d %s ] || { echo "%s is a directory. Use -r to copy it" >&2; exit 1; }`, shellQuote(oper.src.Path), oper.src.Path)
+	}
+	script := fmt.Sprintf("%s; cd %s && tar -cf - %s", check, shellQuote(dir), shellQuote(name))
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := oper.runRemote(remote, script, nil, progress.writer(pw))
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	local, err := utils.ExtractTar(pr, oper.dst.Path, oper.out)
+	if err == nil {
+		// tar pads the archive after its end
+		io.Copy(ioutil.Discard, pr)
+	}
+	// Unblocks ssh when extracting failed half way
+	pr.CloseWithError(err)
+	runErr := <-done
+	if err != nil {
+		return nil, nil, err
+	}
+	if runErr != nil {
+		return nil, nil, runErr
+	}
+
+	var sums bytes.Buffer
+	err = oper.runRemote(remote, "cd "+shellQuote(dir)+" && "+sha256sumScript(shellQuote(name)), nil, &sums)
+	if err != nil {
+		return nil, nil, err
+	}
+	return local, utils.ParseSha256sum(sums.String()), nil
+}
+
+func (oper CpOperation) upload(remote *cpRemote, progress *cpProgress) (utils.CopyChecksums, utils.CopyChecksums, error) {
+	info, err := os.Stat(oper.src.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() && !oper.recursive {
+		return nil, nil, fmt.Errorf("%s is a directory. Use -r to copy it", oper.src.Path)
+	}
+	name := filepath.Base(filepath.Clean(oper.src.Path))
+
+	// Extracted next to the destination first so that it can take the
+	// destination's name. Only the files we sent are checksummed there,
+	// before they are merged with whatever the destination already has
+	script := strings.Join([]string{
+		"set -e",
+		"dest=" + shellQuote(oper.dst.Path),
+		`if [ -d "$dest" ]; then dir="$dest"; name=` + shellQuote(name) + `; else dir=$(dirname "$dest"); name=$(basename "$dest"); mkdir -p "$dir"; fi`,
+		`tmp=$(mktemp -d "$dir/.bcn-cp.XXXXXX")`,
+		`trap 'rm -rf "$tmp"' EXIT`,
+		`tar -C "$tmp" -xf -`,
+		`(cd "$tmp" && ` + sha256sumScript(shellQuote(name)) + `)`,
+		`if [ -d "$dir/$name" ]; then cp -R "$tmp/"` + shellQuote(name) + `/. "$dir/$name/"; else mv "$tmp/"` + shellQuote(name) + ` "$dir/$name"; fi`,
+	}, "\n")
+
+	pr, pw := io.Pipe()
+	var local utils.CopyChecksums
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		local, err = utils.WriteTar(progress.writer(pw), oper.src.Path, oper.out)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	var sums bytes.Buffer
+	err = oper.runRemote(remote, script, pr, &sums)
+	// Stops WriteTar when the remote side gave up early
+	pr.CloseWithError(io.ErrClosedPipe)
+	tarErr := <-done
+	if err != nil {
+		return nil, nil, err
+	}
+	if tarErr != nil {
+		return nil, nil, tarErr
+	}
+	return local, utils.ParseSha256sum(sums.String()), nil
+}
+
+func (oper CpOperation) runRemote(remote *cpRemote, script string, stdin io.Reader, stdout io.Writer) error {
+	sign := func() (*utils.DistrictCertificate, error) {
+		return SignPublicKey(oper.client, remote.district)
+	}
+	return utils.NewCertCache(oper.config).Connect(remote.district, sign, func(cert *utils.DistrictCertificate) error {
+		ssh := utils.NewSshCommandWithOptions(remote.ip, cert, oper.config, oper.commandRunner, utils.SshOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: os.Stderr,
+		})
+		return ssh.Run(remote.shell(script))
+	})
+}
+
+// Finds the instance a spec is on
+func (oper CpOperation) remote(spec CpSpec) (*cpRemote, error) {
+	remote := &cpRemote{}
+	district := spec.District
+	target := spec.Host
+	var oneoff *api.Oneoff
+	var err error
+
+	if spec.OneoffID > 0 {
+		oneoff, district, err = oper.fetchOneoff(spec.OneoffID)
+		if err != nil {
+			return nil, err
+		}
+		if oneoff.Status != "RUNNING" {
+			return nil, fmt.Errorf("Oneoff %d is %s", oneoff.ID, oneoff.Status)
+		}
+		if len(oneoff.ContainerName) == 0 {
+			return nil, fmt.Errorf("Oneoff %d has no container name", oneoff.ID)
+		}
+		target = oneoff.ContainerInstanceARN
+	}
+
+	remote.district = district
+	remote.ip, err = containerInstanceIP(oper.client, district, target)
+	if err != nil {
+		return nil, err
+	}
+
+	sudo := ""
+	if oper.sudo {
+		sudo = "sudo -n "
+	}
+	if oneoff == nil {
+		remote.shell = func(script string) string {
+			return sudo + "sh -c " + shellQuote(script)
+		}
+		return remote, nil
+	}
+
+	find := oneoffContainerScript(oneoff, sudo, false)
+	remote.shell = func(script string) string {
+		return fmt.Sprintf(`%s; %sdocker exec -i "$c" sh -c %s`, find, sudo, shellQuote(script))
+	}
+	return remote, nil
+}
+
+func (oper CpOperation) fetchOneoff(id int) (*api.Oneoff, string, error) {
+	if len(oper.heritageName) == 0 {
+		return nil, "", fmt.Errorf("Copying from or to a oneoff needs its heritage. Please specify it with --environment or --heritage-name")
+	}
+
+	district, err := oneoffDistrict(oper.client, oper.heritageName, oper.districtName)
+	if err != nil {
+		return nil, "", err
+	}
+	path := fmt.Sprintf("%s/%d", oneoffBasePath(district, oper.heritageName), id)
+	oneoff, err := fetchOneoff(oper.client, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return oneoff, district, nil
+}
+
+// Splits a remote path into the directory to run tar in and the name to
+// copy
+func remotePathParts(p string) (string, string, error) {
+	clean := path.Clean(p)
+	name := path.Base(clean)
+	if name == "/" || name == "." || name == ".." {
+		return "", "", fmt.Errorf("%s can't be copied. Please name a file or directory", p)
+	}
+	return path.Dir(clean), name, nil
+}
+
+// Prints the checksums of the files under target, which is already
+// quoted. Prints nothing when sha256sum is missing
+func sha256sumScript(target string) string {
+	return "if command -v sha256sum >/dev/null 2>&1; then find " + target + " -type f -exec sha256sum {} +; fi"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Counts the bytes of the tar stream and shows them on one line that is
+// redrawn while the copy runs
+type cpProgress struct {
+	out   io.Writer
+	count int64
+	start time.Time
+	done  chan struct{}
+	live  bool
+}
+
+func newCpProgress(out io.Writer, live bool) *cpProgress {
+	p := &cpProgress{out: out, start: time.Now(), done: make(chan struct{}), live: live}
+	if live {
+		go p.loop()
+	}
+	return p
+}
+
+func (p *cpProgress) writer(w io.Writer) io.Writer {
+	return &cpProgressWriter{w: w, p: p}
+}
+
+func (p *cpProgress) bytes() int64 {
+	return atomic.LoadInt64(&p.count)
+}
+
+func (p *cpProgress) loop() {
+	ticker := time.NewTicker(cpProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.print()
+		}
+	}
+}
+
+func (p *cpProgress) print() {
+	elapsed := time.Since(p.start).Seconds()
+	rate := int64(0)
+	if elapsed > 0 {
+		rate = int64(float64(p.bytes()) / elapsed)
+	}
+	fmt.Fprintf(p.out, "\r%s (%s/s)   ", formatBytes(p.bytes()), formatBytes(rate))
+}
+
+func (p *cpProgress) stop() {
+	if !p.live {
+		return
+	}
+	close(p.done)
+	p.print()
+	fmt.Fprintln(p.out)
+}
+
+type cpProgressWriter struct {
+	w io.Writer
+	p *cpProgress
+}
+
+func (w *cpProgressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	atomic.AddInt64(&w.p.count, int64(n))
+	return n, err
+}
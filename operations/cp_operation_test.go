@@ -0,0 +1,131 @@
+package operations
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Runs the remote command with the local sh as if ssh got us there
+type localShellRunner struct{}
+
+func (r localShellRunner) RunCommand(name string, arg ...string) error {
+	return r.RunCommandWithStreams(os.Stdin, os.Stdout, os.Stderr, name, arg...)
+}
+
+func (r localShellRunner) RunCommandWithStreams(stdin io.Reader, stdout io.Writer, stderr io.Writer, name string, arg ...string) error {
+	cmd := exec.Command("sh", "-c", arg[len(arg)-1])
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+func TestParseCpSpec(t *testing.T) {
+	cases := map[string]CpSpec{
+		"default:10.0.1.5:/tmp/heap.hprof": {District: "default", Host: "10.0.1.5", Path: "/tmp/heap.hprof"},
+		"default:i-0123:dumps":             {District: "default", Host: "i-0123", Path: "dumps"},
+		"123:/tmp/data.csv":                {OneoffID: 123, Path: "/tmp/data.csv"},
+		"data.csv":                         {Path: "data.csv"},
+		"./a:b:c":                          {Path: "./a:b:c"},
+		"/tmp/123:x":                       {Path: "/tmp/123:x"},
+	}
+	for arg, expected := range cases {
+		if actual := ParseCpSpec(arg); actual != expected {
+			t.Errorf("%s: expected %+v but got %+v", arg, expected, actual)
+		}
+	}
+}
+
+func TestCpOperation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the remote side is run with sh")
+	}
+	if _, err := exec.LookPath("sha256sum"); err != nil {
+		t.Skip("sha256sum is not available")
+	}
+
+	dir := t.TempDir()
+
+	config := MockSshConfigOperationConfig{dir: dir, keyPath: testPrivateKey(dir)}
+	client := &MockSshConfigOperationApiClient{keyPath: config.keyPath, validBefore: time.Now().Add(time.Hour)}
+	cp := func(src, dst string, recursive bool) *runResult {
+		return NewCpOperation(client, ParseCpSpec(src), ParseCpSpec(dst), recursive, false, false, "", "", config, localShellRunner{}, ioutil.Discard).run()
+	}
+
+	local := filepath.Join(dir, "data")
+	os.MkdirAll(filepath.Join(local, "2024"), 0755)
+	ioutil.WriteFile(filepath.Join(local, "2024", "users.csv"), []byte("id,name\n1,hopper\n"), 0644)
+	remote := filepath.Join(dir, "instance")
+	os.MkdirAll(remote, 0755)
+
+	if result := cp(local, "default:10.0.1.5:"+remote, false); !result.is_error {
+		t.Errorf("Expected a directory to need -r")
+	}
+
+	// Into an existing directory, then back under a new name
+	if result := cp(local, "default:10.0.1.5:"+remote, true); result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(remote, "data", "2024", "users.csv")); err != nil || string(b) != "id,name\n1,hopper\n" {
+		t.Fatalf("Expected the directory to be uploaded: %v", err)
+	}
+	// Merging into a directory that has other files
+	ioutil.WriteFile(filepath.Join(remote, "data", "2024", "orders.csv"), []byte("id\n"), 0644)
+	if result := cp(local, "default:10.0.1.5:"+remote, true); result.is_error {
+		t.Fatalf("Expected only the uploaded files to be verified: %s", result.message)
+	}
+
+	back := filepath.Join(dir, "back")
+	if result := cp("default:i-0123:"+filepath.Join(remote, "data"), back, true); result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if _, err := os.Stat(filepath.Join(back, "2024", "users.csv")); err != nil {
+		t.Errorf("Expected the directory to be downloaded: %s", err)
+	}
+
+	// A single file under another name
+	if result := cp("default:10.0.1.5:"+filepath.Join(remote, "data", "2024", "users.csv"), filepath.Join(dir, "users.csv"), false); result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if result := cp(filepath.Join(dir, "users.csv"), "default:10.0.1.5:"+filepath.Join(remote, "renamed.csv"), false); result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(remote, "renamed.csv")); err != nil || string(b) != "id,name\n1,hopper\n" {
+		t.Errorf("Expected the file to be uploaded under the new name: %v", err)
+	}
+
+	if result := cp("default:10.0.1.5:"+filepath.Join(remote, "missing"), dir, false); !result.is_error {
+		t.Errorf("Expected a missing file to be an error")
+	}
+}
+
+type mockCpOneoffClient struct {
+	*MockOneoffOperationApiClient
+}
+
+func (m mockCpOneoffClient) Post(path string, body io.Reader) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected POST %s", path)
+}
+
+func TestCpOperationOneoffDistrict(t *testing.T) {
+	client := mockCpOneoffClient{newMockOneoffClient(map[string][]string{
+		"/heritages/nginx": {`{"heritage":{"name":"nginx","district":{"name":"default"}}}`},
+		"/districts/default/heritages/nginx/oneoffs/12": {`{"oneoff":{"id":12,"status":"RUNNING"}}`},
+	})}
+	oper := NewCpOperation(client, ParseCpSpec("12:/tmp/a"), ParseCpSpec("a"), false, false, false, "nginx", "", MockSshConfigOperationConfig{}, localShellRunner{}, ioutil.Discard)
+
+	oneoff, district, err := oper.fetchOneoff(12)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if oneoff.ID != 12 || district != "default" {
+		t.Errorf("Expected oneoff 12 in default but got %d in %q", oneoff.ID, district)
+	}
+}
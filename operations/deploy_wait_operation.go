@@ -0,0 +1,202 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+// Interval between heritage polls while waiting for a deploy
+var deployWaitInterval = 5 * time.Second
+
+// Number of consecutive polls a service needs to stay settled
+// before the rollout is considered finished
+const deployStablePolls = 3
+
+// Number of consecutive polls a service may have no running and no
+// pending tasks for before we decide its tasks keep failing
+const deployFailurePolls = 6
+
+type DeployWaitOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
+}
+
+type DeployWaitOperation struct {
+	client DeployWaitOperationApiClient
+	// The heritage as returned by the deploy
+	heritage *api.Heritage
+	// When the deploy was sent. Deployments created before it belong to
+	// earlier rollouts
+	since   time.Time
+	timeout time.Duration
+	out     io.Writer
+}
+
+func NewDeployWaitOperation(client DeployWaitOperationApiClient, heritage *api.Heritage, since time.Time, timeout time.Duration, out io.Writer) *DeployWaitOperation {
+	return &DeployWaitOperation{
+		client:   client,
+		heritage: heritage,
+		since:    since,
+		timeout:  timeout,
+		out:      out,
+	}
+}
+
+// Tolerated difference between our clock and Barcelona's when telling
+// whether a deployment was created by this deploy
+const deployClockSkew = 30 * time.Second
+
+type serviceProgress struct {
+	last     string
+	stable   int
+	failures int
+	// Whether a deployment of this rollout has been seen
+	started bool
+}
+
+func serviceSettled(s *api.Service) bool {
+	return s.PendingCount == 0 && s.RunningCount == s.DesiredCount
+}
+
+func serviceFailing(s *api.Service) bool {
+	return s.DesiredCount > 0 && s.PendingCount == 0 && s.RunningCount < s.DesiredCount
+}
+
+// A rollout has started once a second deployment shows up next to the
+// old one, or the primary one was created after the deploy was sent
+func (oper DeployWaitOperation) rolloutStarted(s *api.Service) bool {
+	if len(s.Deployments) > 1 {
+		return true
+	}
+	for _, d := range s.Deployments {
+		if d.Status == "PRIMARY" && !oper.since.IsZero() && d.CreatedAt.After(oper.since.Add(-deployClockSkew)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Only the PRIMARY deployment is left and all of its tasks run
+func rolloutFinished(s *api.Service) bool {
+	if len(s.Deployments) != 1 {
+		return false
+	}
+	d := s.Deployments[0]
+	return d.Status == "PRIMARY" && d.PendingCount == 0 && d.RunningCount == d.DesiredCount
+}
+
+func (oper DeployWaitOperation) fetch() (*api.Heritage, error) {
+	resp, err := oper.client.Get("/heritages/"+oper.heritage.Name, nil)
+	if err != nil {
+		return nil, err
+	}
+	var hResp api.HeritageResponse
+	err = json.Unmarshal(resp, &hResp)
+	if err != nil {
+		return nil, err
+	}
+	if hResp.Heritage == nil {
+		return nil, fmt.Errorf("No such heritage")
+	}
+	return hResp.Heritage, nil
+}
+
+func (oper DeployWaitOperation) run() *runResult {
+	if oper.heritage == nil || len(oper.heritage.Name) == 0 {
+		return error_result("heritage name is required")
+	}
+	name := oper.heritage.Name
+
+	if len(oper.heritage.Services) == 0 {
+		fmt.Fprintf(oper.out, "%s has no services to wait for\n", name)
+		return ok_result()
+	}
+
+	fmt.Fprintf(oper.out, "Waiting for %s to finish deploying\n", name)
+
+	deadline := time.Now().Add(oper.timeout)
+	progress := map[string]*serviceProgress{}
+
+	for {
+		h, err := oper.fetch()
+		if err != nil {
+			return error_result(err.Error())
+		}
+
+		// Until Barcelona has taken the new definition, the services
+		// still show the previous one
+		done := h.Version >= oper.heritage.Version
+
+		services := map[string]*api.Service{}
+		for _, s := range h.Services {
+			services[s.Name] = s
+		}
+
+		for _, expected := range oper.heritage.Services {
+			s, ok := services[expected.Name]
+			if !ok {
+				done = false
+				continue
+			}
+			p, ok := progress[s.Name]
+			if !ok {
+				p = &serviceProgress{}
+				progress[s.Name] = p
+			}
+
+			line := fmt.Sprintf("%s: running %d/%d, pending %d", s.Name, s.RunningCount, s.DesiredCount, s.PendingCount)
+			if len(s.Deployments) > 1 {
+				line += fmt.Sprintf(", %d deployments", len(s.Deployments))
+			}
+			if line != p.last {
+				fmt.Fprintln(oper.out, line)
+				p.last = line
+			}
+
+			if serviceFailing(s) {
+				p.failures++
+			} else {
+				p.failures = 0
+			}
+
+			if p.failures >= deployFailurePolls {
+				return error_result(fmt.Sprintf("%s: tasks keep failing (running %d/%d)", s.Name, s.RunningCount, s.DesiredCount))
+			}
+
+			if s.Deployments == nil {
+				// Barcelona doesn't report deployments, so all we can
+				// go by is the task counts staying settled
+				if serviceSettled(s) {
+					p.stable++
+				} else {
+					p.stable = 0
+				}
+				if p.stable < deployStablePolls {
+					done = false
+				}
+				continue
+			}
+
+			if oper.rolloutStarted(s) {
+				p.started = true
+			}
+			if !p.started || !rolloutFinished(s) {
+				done = false
+			}
+		}
+
+		if done {
+			fmt.Fprintf(oper.out, "%s has been deployed\n", name)
+			return ok_result()
+		}
+
+		if !time.Now().Before(deadline) {
+			return error_result(fmt.Sprintf("Timed out after %s waiting for %s to deploy", oper.timeout, name))
+		}
+
+		time.Sleep(deployWaitInterval)
+	}
+}
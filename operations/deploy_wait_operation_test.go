@@ -0,0 +1,135 @@
+package operations
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+type MockDeployWaitOperationApiClient struct {
+	responses []string
+	calls     int
+}
+
+func (m *MockDeployWaitOperationApiClient) Get(path string, body io.Reader) ([]byte, error) {
+	i := m.calls
+	if i >= len(m.responses) {
+		i = len(m.responses) - 1
+	}
+	m.calls++
+	return bytes.NewBufferString(m.responses[i]).Bytes(), nil
+}
+
+var deployedNginx = &api.Heritage{Name: "nginx", Version: 2, Services: []*api.Service{{Name: "web"}}}
+
+func ExampleDeployWaitOperation_run_output() {
+	deployWaitInterval = 0
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":1,"pending_count":1,"desired_count":2}]}}`,
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":2,"pending_count":0,"desired_count":2}]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, time.Time{}, time.Minute, os.Stdout)
+
+	oper.run()
+	// Output:
+	// Waiting for nginx to finish deploying
+	// web: running 1/2, pending 1
+	// web: running 2/2, pending 0
+	// nginx has been deployed
+}
+
+func TestDeployWaitOperationFailingTasks(t *testing.T) {
+	deployWaitInterval = 0
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":0,"pending_count":0,"desired_count":2}]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, time.Time{}, time.Minute, os.Stdout)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Fatalf("Expected an error but got none")
+	}
+	if result.message != "web: tasks keep failing (running 0/2)" {
+		t.Errorf("Unexpected message: %s", result.message)
+	}
+}
+
+func TestDeployWaitOperationTimeout(t *testing.T) {
+	deployWaitInterval = 0
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":1,"pending_count":1,"desired_count":2}]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, time.Time{}, 0, os.Stdout)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Fatalf("Expected an error but got none")
+	}
+	if result.message != "Timed out after 0s waiting for nginx to deploy" {
+		t.Errorf("Unexpected message: %s", result.message)
+	}
+}
+
+func ExampleDeployWaitOperation_run_deployments() {
+	deployWaitInterval = 0
+	since := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			// Barcelona hasn't taken the new definition yet
+			`{"heritage":{"name":"nginx","version":1,"services":[{"name":"web","running_count":2,"desired_count":2,"deployments":[{"status":"PRIMARY","running_count":2,"desired_count":2,"created_at":"2020-01-01T10:00:00Z"}]}]}}`,
+			// The old tasks still satisfy the counts
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":2,"desired_count":2,"deployments":[{"status":"PRIMARY","running_count":2,"desired_count":2,"created_at":"2020-01-01T10:00:00Z"}]}]}}`,
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":3,"pending_count":1,"desired_count":2,"deployments":[{"status":"PRIMARY","running_count":1,"pending_count":1,"desired_count":2,"created_at":"2020-01-01T12:00:05Z"},{"status":"ACTIVE","running_count":2,"desired_count":2,"created_at":"2020-01-01T10:00:00Z"}]}]}}`,
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":2,"desired_count":2,"deployments":[{"status":"PRIMARY","running_count":2,"desired_count":2,"created_at":"2020-01-01T12:00:05Z"}]}]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, since, time.Minute, os.Stdout)
+
+	oper.run()
+	// Output:
+	// Waiting for nginx to finish deploying
+	// web: running 2/2, pending 0
+	// web: running 3/2, pending 1, 2 deployments
+	// web: running 2/2, pending 0
+	// nginx has been deployed
+}
+
+func TestDeployWaitOperationOldDeployment(t *testing.T) {
+	deployWaitInterval = 0
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			`{"heritage":{"name":"nginx","version":2,"services":[{"name":"web","running_count":2,"desired_count":2,"deployments":[{"status":"PRIMARY","running_count":2,"desired_count":2,"created_at":"2020-01-01T10:00:00Z"}]}]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), 0, os.Stdout)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Fatalf("Expected the deployment from before the deploy not to count")
+	}
+}
+
+func TestDeployWaitOperationMissingService(t *testing.T) {
+	deployWaitInterval = 0
+	client := &MockDeployWaitOperationApiClient{
+		responses: []string{
+			`{"heritage":{"name":"nginx","version":2,"services":[]}}`,
+		},
+	}
+	oper := NewDeployWaitOperation(client, deployedNginx, time.Time{}, 0, os.Stdout)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Fatalf("Expected to wait for the service to show up")
+	}
+}
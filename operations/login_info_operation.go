@@ -2,6 +2,7 @@ package operations
 
 import (
 	"fmt"
+	"io"
 )
 
 type LoginInfo interface {
@@ -20,9 +21,19 @@ func NewLoginInfoOperation(info LoginInfo) *LoginInfoOperation {
 	}
 }
 
+type loginInfoResult struct {
+	Endpoint string `json:"endpoint"`
+	Auth     string `json:"auth"`
+}
+
 func (oper LoginInfoOperation) run() *runResult {
-	fmt.Printf("Endpoint: %s\n", oper.info.GetEndpoint())
-	fmt.Printf("Auth:     %s\n", oper.info.GetAuth())
+	info := loginInfoResult{
+		Endpoint: oper.info.GetEndpoint(),
+		Auth:     oper.info.GetAuth(),
+	}
 
-	return ok_result()
+	return render(info, func(w io.Writer) {
+		fmt.Fprintf(w, "Endpoint: %s\n", info.Endpoint)
+		fmt.Fprintf(w, "Auth:     %s\n", info.Auth)
+	})
 }
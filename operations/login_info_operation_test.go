@@ -1,6 +1,8 @@
 package operations
 
-import ()
+import (
+	"github.com/degica/barcelona-cli/config"
+)
 
 type mockLogin struct{}
 
@@ -21,3 +23,17 @@ func ExampleLoginInfoOperation_run_output() {
 	// Endpoint: https://example.com
 	// Auth:     fooauth
 }
+
+func ExampleLoginInfoOperation_run_json() {
+	config.Output = "json"
+	defer func() { config.Output = "" }()
+
+	op := NewLoginInfoOperation(&mockLogin{})
+	op.run()
+
+	// Output:
+	// {
+	//   "endpoint": "https://example.com",
+	//   "auth": "fooauth"
+	// }
+}
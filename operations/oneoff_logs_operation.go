@@ -0,0 +1,99 @@
+package operations
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/degica/barcelona-cli/utils"
+)
+
+// OneoffLogsOperation prints a oneoff's container output with docker
+// logs on the instance it runs on. The container is found until ECS
+// cleans it up after the task stopped
+type OneoffLogsOperation struct {
+	client       SshcmdOperationApiClient
+	heritageName string
+	districtName string
+	id           int
+	follow       bool
+	// Number of lines from the end to start with. Zero prints all
+	tail          int
+	config        utils.SshConfig
+	commandRunner utils.SshCommandRunner
+}
+
+// districtName may be empty, in which case it is looked up from the heritage
+func NewOneoffLogsOperation(
+	client SshcmdOperationApiClient,
+	heritageName string,
+	districtName string,
+	id int,
+	follow bool,
+	tail int,
+	config utils.SshConfig,
+	commandRunner utils.SshCommandRunner) *OneoffLogsOperation {
+	return &OneoffLogsOperation{
+		client:        client,
+		heritageName:  heritageName,
+		districtName:  districtName,
+		id:            id,
+		follow:        follow,
+		tail:          tail,
+		config:        config,
+		commandRunner: commandRunner,
+	}
+}
+
+// The remote command that prints the logs
+func (oper OneoffLogsOperation) script(find string) string {
+	logs := "docker logs"
+	if oper.follow {
+		logs += " --follow"
+	}
+	if oper.tail > 0 {
+		logs += " --tail " + strconv.Itoa(oper.tail)
+	}
+	return "sh -c " + shellQuote(find+"; "+logs+` "$c"`)
+}
+
+func (oper OneoffLogsOperation) run() *runResult {
+	if len(oper.heritageName) == 0 {
+		return error_result("heritage name is required")
+	}
+	if oper.id <= 0 {
+		return error_result("oneoff ID is required")
+	}
+
+	district, err := oneoffDistrict(oper.client, oper.heritageName, oper.districtName)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	o, err := fetchOneoff(oper.client, fmt.Sprintf("%s/%d", oneoffBasePath(district, oper.heritageName), oper.id))
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if len(o.ContainerInstanceARN) == 0 || len(o.ContainerName) == 0 {
+		return error_result(fmt.Sprintf("Oneoff %d is %s and has no container yet", o.ID, o.Status))
+	}
+
+	ip, err := containerInstanceIP(oper.client, district, o.ContainerInstanceARN)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	sign := func() (*utils.DistrictCertificate, error) {
+		return SignPublicKey(oper.client, district)
+	}
+	err = utils.NewCertCache(oper.config).Connect(district, sign, func(cert *utils.DistrictCertificate) error {
+		ssh := utils.NewSshCommandWithOptions(ip, cert, oper.config, oper.commandRunner, utils.SshOptions{
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+		return ssh.Run(oper.script(oneoffContainerScript(o, "", true)))
+	})
+	if err != nil {
+		return error_result(err.Error())
+	}
+	return ok_result()
+}
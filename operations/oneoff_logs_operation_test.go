@@ -0,0 +1,62 @@
+package operations
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockOneoffLogsClient struct {
+	*MockOneoffOperationApiClient
+	signer *MockSshConfigOperationApiClient
+}
+
+func (m mockOneoffLogsClient) Post(path string, body io.Reader) ([]byte, error) {
+	return m.signer.Post(path, body)
+}
+
+type recordingSshRunner struct {
+	command string
+}
+
+func (r *recordingSshRunner) RunCommand(name string, arg ...string) error {
+	r.command = arg[len(arg)-1]
+	return nil
+}
+
+func TestOneoffLogsOperation(t *testing.T) {
+	dir := t.TempDir()
+	config := MockSshConfigOperationConfig{dir: dir, keyPath: testPrivateKey(dir)}
+	oneoffs := newMockOneoffClient(map[string][]string{
+		"/heritages/nginx": {`{"heritage":{"name":"nginx","district":{"name":"default"}}}`},
+		"/districts/default/heritages/nginx/oneoffs/12": {`{"oneoff":{"id":12,"status":"STOPPED","task_arn":"arn:task","container_name":"nginx-oneoff","container_instance_arn":"arn:aws:ecs:ap-northeast-1:123:container-instance/default/abc"}}`},
+		"/districts/default":                            {`{"district":{"name":"default","container_instances":[{"container_instance_arn":"arn:aws:ecs:ap-northeast-1:123:container-instance/default/abc","private_ip_address":"10.0.1.5"}]}}`},
+	})
+	client := mockOneoffLogsClient{oneoffs, &MockSshConfigOperationApiClient{keyPath: config.keyPath, validBefore: time.Now().Add(time.Hour)}}
+	runner := &recordingSshRunner{}
+
+	result := NewOneoffLogsOperation(client, "nginx", "", 12, true, 100, config, runner).run()
+	if result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	for _, expected := range []string{
+		"docker ps -a -q --filter label=com.amazonaws.ecs.task-arn='\\''arn:task'\\'' --filter label=com.amazonaws.ecs.container-name='\\''nginx-oneoff'\\''",
+		`docker logs --follow --tail 100 "$c"`,
+	} {
+		if !strings.Contains(runner.command, expected) {
+			t.Errorf("Expected %s in %s", expected, runner.command)
+		}
+	}
+}
+
+func TestOneoffLogsOperationPending(t *testing.T) {
+	client := mockOneoffLogsClient{newMockOneoffClient(map[string][]string{
+		"/districts/default/heritages/nginx/oneoffs/12": {`{"oneoff":{"id":12,"status":"PENDING"}}`},
+	}), nil}
+
+	result := NewOneoffLogsOperation(client, "nginx", "default", 12, false, 0, MockSshConfigOperationConfig{}, &recordingSshRunner{}).run()
+	if !result.is_error || result.message != "Oneoff 12 is PENDING and has no container yet" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
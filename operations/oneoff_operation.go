@@ -0,0 +1,215 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/olekukonko/tablewriter"
+)
+
+type OneoffOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
+	Delete(path string, body io.Reader) ([]byte, error)
+}
+
+type OneoffOperation struct {
+	heritage_name string
+	district_name string
+	op_type       OperationType
+	id            int
+	client        OneoffOperationApiClient
+	clock         oneoffClock
+}
+
+// district_name may be empty, in which case it is looked up from the heritage
+func NewOneoffOperation(heritage_name string, district_name string, op_type OperationType, id int, client OneoffOperationApiClient) *OneoffOperation {
+	return &OneoffOperation{
+		heritage_name: heritage_name,
+		district_name: district_name,
+		op_type:       op_type,
+		id:            id,
+		client:        client,
+		clock:         realClock{},
+	}
+}
+
+// Anything that can GET from Barcelona
+type apiGetter interface {
+	Get(path string, body io.Reader) ([]byte, error)
+}
+
+// Returns the district a heritage's oneoffs run in. An empty
+// district_name is looked up from the heritage
+func oneoffDistrict(client apiGetter, heritage_name string, district_name string) (string, error) {
+	if len(district_name) > 0 {
+		return district_name, nil
+	}
+	resp, err := client.Get("/heritages/"+heritage_name, nil)
+	if err != nil {
+		return "", err
+	}
+	var hResp api.HeritageResponse
+	err = json.Unmarshal(resp, &hResp)
+	if err != nil {
+		return "", err
+	}
+	if hResp.Heritage == nil {
+		return "", fmt.Errorf("No such heritage")
+	}
+	if hResp.Heritage.District == nil {
+		return "", fmt.Errorf("Could not find the district of %s. Please specify it with --district", heritage_name)
+	}
+	return hResp.Heritage.District.Name, nil
+}
+
+func oneoffBasePath(district_name string, heritage_name string) string {
+	return fmt.Sprintf("/districts/%s/heritages/%s/oneoffs", district_name, heritage_name)
+}
+
+func (oper OneoffOperation) basePath() (string, error) {
+	district, err := oneoffDistrict(oper.client, oper.heritage_name, oper.district_name)
+	if err != nil {
+		return "", err
+	}
+	return oneoffBasePath(district, oper.heritage_name), nil
+}
+
+func fetchOneoff(client apiGetter, path string) (*api.Oneoff, error) {
+	resp, err := client.Get(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	var oResp api.OneoffResponse
+	err = json.Unmarshal(resp, &oResp)
+	if err != nil {
+		return nil, err
+	}
+	if oResp.Oneoff == nil {
+		return nil, fmt.Errorf("No such oneoff")
+	}
+	return oResp.Oneoff, nil
+}
+
+// Shell that sets $c to the ID of the oneoff's container on its
+// instance, which the ECS agent labels with the task and container name.
+// stopped also finds the container after it has exited
+func oneoffContainerScript(o *api.Oneoff, sudo string, stopped bool) string {
+	all := ""
+	if stopped {
+		all = "-a "
+	}
+	return fmt.Sprintf(`c=$(%sdocker ps %s-q --filter label=com.amazonaws.ecs.task-arn=%s --filter label=com.amazonaws.ecs.container-name=%s | head -n 1); [ -n "$c" ] || { echo "Could not find the container of oneoff %d" >&2; exit 1; }`,
+		sudo, all, shellQuote(o.TaskARN), shellQuote(o.ContainerName), o.ID)
+}
+
+// OneoffExecCommand is the remote command that runs a oneoff's command
+// in its container without a TTY. InteractiveRunCommand asks docker for
+// one, which fails when bcn's output is not a terminal
+func OneoffExecCommand(o *api.Oneoff) (string, error) {
+	if len(o.TaskARN) == 0 || len(o.ContainerName) == 0 {
+		return "", fmt.Errorf("Oneoff %d has no container to run the command in", o.ID)
+	}
+	return fmt.Sprintf(`%s; docker exec -i "$c" sh -c %s`, oneoffContainerScript(o, "", false), shellQuote(o.Command)), nil
+}
+
+func oneoff_list(oper OneoffOperation, base string) *runResult {
+	resp, err := oper.client.Get(base, nil)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	var oResp api.OneoffResponse
+	err = json.Unmarshal(resp, &oResp)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	oneoffs := oResp.Oneoffs
+	if oneoffs == nil {
+		oneoffs = []*api.Oneoff{}
+	}
+
+	return render(oneoffs, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"ID", "Status", "Exit Code", "Command"})
+		table.SetBorder(false)
+		for _, o := range oneoffs {
+			table.Append([]string{strconv.Itoa(o.ID), o.Status, o.ExitCode, o.Command})
+		}
+		table.Render()
+	})
+}
+
+func oneoff_show(oper OneoffOperation, path string) *runResult {
+	o, err := fetchOneoff(oper.client, path)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	return render(o, o.Fprint)
+}
+
+func oneoff_wait(oper OneoffOperation, path string) *runResult {
+	waiter := NewOneoffWaiter(oper.client, path, os.Stderr)
+	waiter.clock = oper.clock
+	o, err := waiter.WaitForStop(context.Background(), 0)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	result := render(o, o.Fprint)
+	if result.is_error {
+		return result
+	}
+	return oneoffResult(o)
+}
+
+func oneoff_stop(oper OneoffOperation, path string) *runResult {
+	resp, err := oper.client.Delete(path, nil)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	var oResp api.OneoffResponse
+	err = json.Unmarshal(resp, &oResp)
+	if err != nil || oResp.Oneoff == nil {
+		// Barcelona didn't say how the oneoff is doing yet
+		return render(&api.Oneoff{ID: oper.id}, func(w io.Writer) {
+			fmt.Fprintf(w, "Stopping oneoff %d\n", oper.id)
+		})
+	}
+	return render(oResp.Oneoff, oResp.Oneoff.Fprint)
+}
+
+func (oper OneoffOperation) run() *runResult {
+	if len(oper.heritage_name) == 0 {
+		return error_result("heritage name is required")
+	}
+
+	base, err := oper.basePath()
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	if oper.op_type == List {
+		return oneoff_list(oper, base)
+	}
+
+	if oper.id <= 0 {
+		return error_result("oneoff ID is required")
+	}
+	path := fmt.Sprintf("%s/%d", base, oper.id)
+
+	switch oper.op_type {
+	case Show:
+		return oneoff_show(oper, path)
+	case Wait:
+		return oneoff_wait(oper, path)
+	case Stop:
+		return oneoff_stop(oper, path)
+	}
+
+	return error_result("unknown operation")
+}
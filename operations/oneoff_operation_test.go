@@ -0,0 +1,134 @@
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+type MockOneoffOperationApiClient struct {
+	responses map[string][]string
+	calls     map[string]int
+	deleted   []string
+}
+
+func newMockOneoffClient(responses map[string][]string) *MockOneoffOperationApiClient {
+	return &MockOneoffOperationApiClient{
+		responses: responses,
+		calls:     map[string]int{},
+	}
+}
+
+func (m *MockOneoffOperationApiClient) Get(path string, body io.Reader) ([]byte, error) {
+	responses, ok := m.responses[path]
+	if !ok {
+		return nil, fmt.Errorf("unexpected path %s", path)
+	}
+	i := m.calls[path]
+	if i >= len(responses) {
+		i = len(responses) - 1
+	}
+	m.calls[path]++
+	return bytes.NewBufferString(responses[i]).Bytes(), nil
+}
+
+func (m *MockOneoffOperationApiClient) Delete(path string, body io.Reader) ([]byte, error) {
+	m.deleted = append(m.deleted, path)
+	return bytes.NewBufferString(`{"oneoff":{"id":12,"status":"RUNNING","command":"rake db:migrate","task_arn":"arn:task"}}`).Bytes(), nil
+}
+
+func ExampleOneoffOperation_run_show() {
+	client := newMockOneoffClient(map[string][]string{
+		"/heritages/nginx": {`{"heritage":{"name":"nginx","district":{"name":"default"}}}`},
+		"/districts/default/heritages/nginx/oneoffs/12": {`{"oneoff":{"id":12,"status":"STOPPED","command":"rake db:migrate","exit_code":"1","task_arn":"arn:task"}}`},
+	})
+	oper := NewOneoffOperation("nginx", "", Show, 12, client)
+
+	oper.run()
+	// Output:
+	// ID:        12
+	// Status:    STOPPED
+	// Command:   rake db:migrate
+	// Exit Code: 1
+	// Task ARN:  arn:task
+}
+
+func TestOneoffOperationWaitExitCode(t *testing.T) {
+	client := newMockOneoffClient(map[string][]string{
+		"/districts/staging/heritages/nginx/oneoffs/12": {
+			`{"oneoff":{"id":12,"status":"RUNNING"}}`,
+			`{"oneoff":{"id":12,"status":"STOPPED","exit_code":"3"}}`,
+		},
+	})
+	oper := NewOneoffOperation("nginx", "staging", Wait, 12, client)
+	oper.clock = &fakeClock{}
+
+	result := oper.run()
+	if !result.is_error || result.exit_code != 3 {
+		t.Errorf("Expected exit code 3 but got %+v", result)
+	}
+}
+
+func TestOneoffOperationWaitSuccess(t *testing.T) {
+	client := newMockOneoffClient(map[string][]string{
+		"/districts/staging/heritages/nginx/oneoffs/12": {`{"oneoff":{"id":12,"status":"STOPPED","exit_code":"0"}}`},
+	})
+	oper := NewOneoffOperation("nginx", "staging", Wait, 12, client)
+	oper.clock = &fakeClock{}
+
+	result := oper.run()
+	if result.is_error {
+		t.Errorf("Expected success but got %s", result.message)
+	}
+}
+
+func TestOneoffOperationStop(t *testing.T) {
+	client := newMockOneoffClient(map[string][]string{})
+	oper := NewOneoffOperation("nginx", "staging", Stop, 12, client)
+
+	result := oper.run()
+	if result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if len(client.deleted) != 1 || client.deleted[0] != "/districts/staging/heritages/nginx/oneoffs/12" {
+		t.Errorf("Unexpected DELETE requests: %v", client.deleted)
+	}
+}
+
+func TestOneoffOperationUnknownDistrict(t *testing.T) {
+	client := newMockOneoffClient(map[string][]string{
+		"/heritages/nginx": {`{"heritage":{"name":"nginx"}}`},
+	})
+	oper := NewOneoffOperation("nginx", "", List, 0, client)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Errorf("Expected an error but got none")
+	}
+}
+
+func TestOneoffExecCommand(t *testing.T) {
+	command, err := OneoffExecCommand(&api.Oneoff{ID: 12, TaskARN: "arn:task", ContainerName: "web", Command: "echo 'hi'"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, expected := range []string{
+		"--filter label=com.amazonaws.ecs.task-arn='arn:task' --filter label=com.amazonaws.ecs.container-name='web'",
+		`docker exec -i "$c" sh -c 'echo '\''hi'\'''`,
+	} {
+		if !strings.Contains(command, expected) {
+			t.Errorf("Expected %s in %s", expected, command)
+		}
+	}
+	if strings.Contains(command, "-it") {
+		t.Errorf("Expected no TTY in %s", command)
+	}
+
+	if _, err := OneoffExecCommand(&api.Oneoff{ID: 12, Command: "bash"}); err == nil {
+		t.Errorf("Expected an error without a container")
+	}
+}
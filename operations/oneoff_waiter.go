@@ -0,0 +1,167 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+const (
+	oneoffPollMinInterval = 1 * time.Second
+	oneoffPollMaxInterval = 15 * time.Second
+	// Each interval is randomly shortened or lengthened by up to this much
+	oneoffPollJitter = 0.2
+)
+
+type oneoffClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// OneoffWaiter polls a oneoff with exponential backoff until it reaches
+// the status we are waiting for. bcn run and bcn oneoff wait share it
+type OneoffWaiter struct {
+	client OneoffOperationApiClient
+	clock  oneoffClock
+	path   string
+	random func() float64
+	// Status changes are reported here
+	out io.Writer
+}
+
+// path is the oneoff's /districts/D/heritages/H/oneoffs/ID. out may be
+// nil when status changes should not be reported
+func NewOneoffWaiter(client OneoffOperationApiClient, path string, out io.Writer) *OneoffWaiter {
+	if out == nil {
+		out = ioutil.Discard
+	}
+	return &OneoffWaiter{
+		client: client,
+		clock:  realClock{},
+		path:   path,
+		random: rand.Float64,
+		out:    out,
+	}
+}
+
+func (w *OneoffWaiter) Fetch() (*api.Oneoff, error) {
+	return fetchOneoff(w.client, w.path)
+}
+
+// Returns the interval to wait after the given number of polls
+func (w *OneoffWaiter) interval(attempt int) time.Duration {
+	d := oneoffPollMinInterval
+	for i := 0; i < attempt && d < oneoffPollMaxInterval; i++ {
+		d *= 2
+	}
+	if d > oneoffPollMaxInterval {
+		d = oneoffPollMaxInterval
+	}
+	jitter := 1 + oneoffPollJitter*(2*w.random()-1)
+	return time.Duration(float64(d) * jitter)
+}
+
+// Polls until done returns true for the oneoff. A zero timeout waits
+// for as long as ctx allows. goal describes what we wait for in the
+// timeout error
+func (w *OneoffWaiter) wait(ctx context.Context, timeout time.Duration, goal string, done func(o *api.Oneoff) bool) (*api.Oneoff, error) {
+	deadline := w.clock.Now().Add(timeout)
+	status := ""
+
+	for attempt := 0; ; attempt++ {
+		o, err := w.Fetch()
+		if err != nil {
+			return nil, err
+		}
+		if o.Status != status {
+			fmt.Fprintf(w.out, "Oneoff %d is %s\n", o.ID, o.Status)
+			status = o.Status
+		}
+		if done(o) {
+			return o, nil
+		}
+		if ctx.Err() != nil {
+			return o, ctx.Err()
+		}
+
+		interval := w.interval(attempt)
+		if timeout > 0 {
+			remaining := deadline.Sub(w.clock.Now())
+			if remaining <= 0 {
+				return o, fmt.Errorf("Timed out after %s waiting for oneoff %d to %s", timeout, o.ID, goal)
+			}
+			if interval > remaining {
+				interval = remaining
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return o, ctx.Err()
+		case <-w.clock.After(interval):
+		}
+	}
+}
+
+// Waits until the oneoff has left PENDING
+func (w *OneoffWaiter) WaitForStart(ctx context.Context, timeout time.Duration) (*api.Oneoff, error) {
+	return w.wait(ctx, timeout, "start", func(o *api.Oneoff) bool {
+		return o.Status != "PENDING"
+	})
+}
+
+// Waits until the oneoff has STOPPED
+func (w *OneoffWaiter) WaitForStop(ctx context.Context, timeout time.Duration) (*api.Oneoff, error) {
+	return w.wait(ctx, timeout, "stop", func(o *api.Oneoff) bool {
+		return o.Status == "STOPPED"
+	})
+}
+
+// Asks Barcelona to stop the oneoff so it is not left running
+func (w *OneoffWaiter) Stop() error {
+	_, err := w.client.Delete(w.path, nil)
+	return err
+}
+
+// Turns a stopped oneoff into a result carrying its exit status. A task
+// stopped by the platform has no exit code and its reason is the message
+func oneoffResult(o *api.Oneoff) *runResult {
+	if len(o.ExitCode) == 0 {
+		reason := o.Reason
+		if len(reason) == 0 {
+			reason = "unknown reason"
+		}
+		return error_result("The task was stopped: " + reason)
+	}
+
+	code, err := strconv.Atoi(o.ExitCode)
+	if err != nil {
+		return error_result(fmt.Sprintf("Unexpected exit code %q", o.ExitCode))
+	}
+	if code == 0 {
+		return ok_result()
+	}
+	return exit_result(o.Reason, code)
+}
+
+// OneoffExitError is bcn's exit status for a stopped oneoff, nil when it
+// succeeded
+func OneoffExitError(o *api.Oneoff) error {
+	return resultError(oneoffResult(o))
+}
@@ -0,0 +1,177 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/urfave/cli"
+)
+
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+type fakeOneoffClient struct {
+	statuses []string
+	gets     int
+	deletes  int
+}
+
+func (c *fakeOneoffClient) Get(path string, body io.Reader) ([]byte, error) {
+	i := c.gets
+	if i >= len(c.statuses) {
+		i = len(c.statuses) - 1
+	}
+	c.gets++
+	return bytes.NewBufferString(`{"oneoff":{"id":1,"status":"` + c.statuses[i] + `"}}`).Bytes(), nil
+}
+
+func (c *fakeOneoffClient) Delete(path string, body io.Reader) ([]byte, error) {
+	c.deletes++
+	return []byte("{}"), nil
+}
+
+func newFakeOneoffWaiter(client *fakeOneoffClient, clock *fakeClock) *OneoffWaiter {
+	w := NewOneoffWaiter(client, "/districts/default/heritages/nginx/oneoffs/1", nil)
+	w.clock = clock
+	w.random = func() float64 { return 0.5 }
+	return w
+}
+
+func TestOneoffWaiterBackoff(t *testing.T) {
+	client := &fakeOneoffClient{statuses: []string{"PENDING", "PENDING", "PENDING", "PENDING", "PENDING", "PENDING", "RUNNING"}}
+	clock := &fakeClock{}
+	w := newFakeOneoffWaiter(client, clock)
+
+	o, err := w.WaitForStart(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if o.Status != "RUNNING" {
+		t.Errorf("Expected RUNNING but got %s", o.Status)
+	}
+
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 15 * time.Second, 15 * time.Second}
+	if len(clock.sleeps) != len(expected) {
+		t.Fatalf("Expected %v but got %v", expected, clock.sleeps)
+	}
+	for i := range expected {
+		if clock.sleeps[i] != expected[i] {
+			t.Errorf("Expected %v but got %v", expected, clock.sleeps)
+			break
+		}
+	}
+}
+
+func TestOneoffWaiterJitter(t *testing.T) {
+	w := newFakeOneoffWaiter(&fakeOneoffClient{}, &fakeClock{})
+
+	w.random = func() float64 { return 0 }
+	if d := w.interval(0); d != 800*time.Millisecond {
+		t.Errorf("Expected 800ms but got %s", d)
+	}
+	w.random = func() float64 { return 1 }
+	if d := w.interval(0); d != 1200*time.Millisecond {
+		t.Errorf("Expected 1.2s but got %s", d)
+	}
+}
+
+func TestOneoffWaiterTimeout(t *testing.T) {
+	client := &fakeOneoffClient{statuses: []string{"PENDING"}}
+	clock := &fakeClock{}
+	w := newFakeOneoffWaiter(client, clock)
+
+	_, err := w.WaitForStart(context.Background(), 10*time.Second)
+	if err == nil || err.Error() != "Timed out after 10s waiting for oneoff 1 to start" {
+		t.Fatalf("Expected a timeout but got %v", err)
+	}
+	if clock.now.Sub(time.Time{}) != 10*time.Second {
+		t.Errorf("Expected to give up after 10s but waited %s", clock.now.Sub(time.Time{}))
+	}
+}
+
+func TestOneoffWaiterCancel(t *testing.T) {
+	client := &fakeOneoffClient{statuses: []string{"PENDING"}}
+	w := newFakeOneoffWaiter(client, &fakeClock{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	o, err := w.WaitForStart(ctx, 0)
+	if err != context.Canceled {
+		t.Fatalf("Expected the wait to be canceled but got %v", err)
+	}
+	if o == nil || o.Status != "PENDING" {
+		t.Errorf("Expected the last seen oneoff to be returned")
+	}
+
+	err = w.Stop()
+	if err != nil || client.deletes != 1 {
+		t.Errorf("Expected the oneoff to be stopped")
+	}
+}
+
+func TestOneoffWaiterWaitForStop(t *testing.T) {
+	client := &fakeOneoffClient{statuses: []string{"RUNNING", "RUNNING", "STOPPED"}}
+	w := newFakeOneoffWaiter(client, &fakeClock{})
+
+	o, err := w.WaitForStop(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if o.Status != "STOPPED" || client.gets != 3 {
+		t.Errorf("Expected to poll until STOPPED but got %s after %d polls", o.Status, client.gets)
+	}
+}
+
+func TestOneoffWaiterWaitForStopTimeout(t *testing.T) {
+	client := &fakeOneoffClient{statuses: []string{"RUNNING"}}
+	w := newFakeOneoffWaiter(client, &fakeClock{})
+
+	_, err := w.WaitForStop(context.Background(), time.Minute)
+	if err == nil || err.Error() != "Timed out after 1m0s waiting for oneoff 1 to stop" {
+		t.Fatalf("Expected a timeout but got %v", err)
+	}
+}
+
+func TestOneoffExitError(t *testing.T) {
+	err := OneoffExitError(&api.Oneoff{Status: "STOPPED", ExitCode: "0"})
+	if err != nil {
+		t.Errorf("Expected no error for exit code 0 but got %s", err)
+	}
+
+	err = OneoffExitError(&api.Oneoff{Status: "STOPPED", ExitCode: "3", Reason: "Essential container in task exited"})
+	exitErr, ok := err.(cli.ExitCoder)
+	if !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("Expected exit code 3 but got %v", err)
+	}
+	if exitErr.Error() != "Essential container in task exited" {
+		t.Errorf("Expected the reason to be kept but got %q", exitErr.Error())
+	}
+
+	err = OneoffExitError(&api.Oneoff{Status: "STOPPED", Reason: "Task failed ELB health checks"})
+	exitErr, ok = err.(cli.ExitCoder)
+	if !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("Expected exit code 1 but got %v", err)
+	}
+	if exitErr.Error() != "The task was stopped: Task failed ELB health checks" {
+		t.Errorf("Unexpected message: %s", exitErr.Error())
+	}
+}
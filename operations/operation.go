@@ -1,6 +1,11 @@
 package operations
 
 import (
+	"io"
+	"os"
+
+	"github.com/degica/barcelona-cli/config"
+	"github.com/degica/barcelona-cli/utils"
 	"github.com/urfave/cli"
 )
 
@@ -9,19 +14,27 @@ type Operation interface {
 }
 
 type runResult struct {
-	is_error bool
-	message  string
+	is_error  bool
+	message   string
+	exit_code int
 }
 
 func Execute(oper Operation) error {
-	run_result := oper.run()
+	return resultError(oper.run())
+}
 
+// Turns a result into the error urfave/cli exits with
+func resultError(run_result *runResult) error {
 	if run_result == nil {
 		return nil
 	}
 
 	if run_result.is_error {
-		return cli.NewExitError(run_result.message, 1)
+		code := run_result.exit_code
+		if code == 0 {
+			code = 1
+		}
+		return cli.NewExitError(run_result.message, code)
 	}
 
 	return nil
@@ -34,6 +47,15 @@ func error_result(message string) *runResult {
 	}
 }
 
+// Fails with a specific exit status instead of 1
+func exit_result(message string, exit_code int) *runResult {
+	return &runResult{
+		message:   message,
+		is_error:  true,
+		exit_code: exit_code,
+	}
+}
+
 func ok_result() *runResult {
 	return &runResult{
 		message:  "",
@@ -41,9 +63,37 @@ func ok_result() *runResult {
 	}
 }
 
+// Render writes v to stdout in the format chosen with --output. human
+// prints the table format
+func Render(v interface{}, human func(w io.Writer)) error {
+	return utils.NewRenderer(config.Output, os.Stdout).Render(v, human)
+}
+
+// Render as the result of an operation
+func render(v interface{}, human func(w io.Writer)) *runResult {
+	err := Render(v, human)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	return ok_result()
+}
+
+// NoticeWriter is where progress goes. It is stderr when the result is
+// written as JSON or YAML so it doesn't end up in the structured output
+func NoticeWriter() io.Writer {
+	if utils.NewRenderer(config.Output, os.Stdout).IsStructured() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
 type OperationType string
 
 const (
-	Delete OperationType = "Delete"
-	Show                 = "Show"
+	Delete   OperationType = "Delete"
+	Show                   = "Show"
+	List                   = "List"
+	Rollback               = "Rollback"
+	Wait                   = "Wait"
+	Stop                   = "Stop"
 )
@@ -3,6 +3,7 @@ package operations
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"path/filepath"
 )
 
@@ -138,6 +139,11 @@ func useProfile(oper profileManipulationInterface, name string) *runResult {
 	return ok_result()
 }
 
+type profileResult struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
 func showProfile(oper profileManipulationInterface, name string) *runResult {
 	var profile_name, _ = oper.currentProfileName()
 	var url = oper.GetEndpoint()
@@ -152,10 +158,10 @@ func showProfile(oper profileManipulationInterface, name string) *runResult {
 		url = pfile.Login.Endpoint
 	}
 
-	fmt.Println("Profile:", profile_name)
-	fmt.Println("URL:", url)
-
-	return ok_result()
+	return render(profileResult{Name: profile_name, URL: url}, func(w io.Writer) {
+		fmt.Fprintln(w, "Profile:", profile_name)
+		fmt.Fprintln(w, "URL:", url)
+	})
 }
 
 func initializeProfiles(oper profileManipulationInterface) error {
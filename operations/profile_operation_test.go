@@ -268,6 +268,21 @@ func Example_showProfile_with_no_param() {
 	// URL: https://default.endpoint
 }
 
+func Example_showProfile_json() {
+	config.Output = "json"
+	defer func() { config.Output = "" }()
+
+	oper := MockProfileManipulationForShowProfile{}
+
+	showProfile(oper, "")
+
+	// Output:
+	// {
+	//   "name": "thedefaultprofile",
+	//   "url": "https://default.endpoint"
+	// }
+}
+
 func Example_showProfile_with_specified_profile() {
 
 	oper := MockProfileManipulationForShowProfile{
@@ -0,0 +1,196 @@
+package operations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Release history comes from Barcelona's heritage release endpoints
+//
+//	GET /heritages/NAME/releases          {"releases": [...]}
+//	GET /heritages/NAME/releases/VERSION  {"release": {...}}
+//
+// Each release carries the heritage definition deployed as that version,
+// which a rollback PATCHes back like bcn deploy does. The endpoints are
+// served by Barcelona and not defined here; a server without them makes
+// list and rollback fail with its API error
+type ReleaseOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
+	Patch(path string, body io.Reader) ([]byte, error)
+}
+
+type ReleaseOperation struct {
+	heritage_name string
+	op_type       OperationType
+	version       int
+	no_confirm    bool
+	wait          bool
+	timeout       time.Duration
+	client        ReleaseOperationApiClient
+	input_reader  utils.UserInputReader
+}
+
+// version is the release to roll back to. Zero means the release before the current one
+func NewReleaseOperation(heritage_name string, op_type OperationType, version int, no_confirm bool, wait bool, timeout time.Duration, client ReleaseOperationApiClient, input_reader utils.UserInputReader) *ReleaseOperation {
+	return &ReleaseOperation{
+		heritage_name: heritage_name,
+		op_type:       op_type,
+		version:       version,
+		no_confirm:    no_confirm,
+		wait:          wait,
+		timeout:       timeout,
+		client:        client,
+		input_reader:  input_reader,
+	}
+}
+
+func (oper ReleaseOperation) releases() ([]*api.Release, error) {
+	resp, err := oper.client.Get("/heritages/"+oper.heritage_name+"/releases", nil)
+	if err != nil {
+		return nil, err
+	}
+	var rResp api.ReleaseResponse
+	err = json.Unmarshal(resp, &rResp)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := rResp.Releases
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Version > releases[j].Version
+	})
+	return releases, nil
+}
+
+func releaseImageTag(r *api.Release) string {
+	if len(r.ImageTag) == 0 && r.Heritage != nil {
+		return r.Heritage.ImageTag
+	}
+	return r.ImageTag
+}
+
+func release_list(oper ReleaseOperation) *runResult {
+	releases, err := oper.releases()
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	return render(releases, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Version", "Image Tag", "Deployed At", "Deployed By", "Description"})
+		table.SetBorder(false)
+		for _, r := range releases {
+			table.Append([]string{strconv.Itoa(r.Version), releaseImageTag(r), r.CreatedAt, r.DeployedBy, r.Description})
+		}
+		table.Render()
+	})
+}
+
+type releaseRollbackResult struct {
+	Heritage string `json:"heritage"`
+	Version  int    `json:"version"`
+}
+
+func release_rollback(oper ReleaseOperation) *runResult {
+	releases, err := oper.releases()
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if len(releases) == 0 {
+		return error_result("No releases found")
+	}
+
+	current := releases[0].Version
+	target := oper.version
+	if target == 0 {
+		if len(releases) < 2 {
+			return error_result("There is no previous release to roll back to")
+		}
+		target = releases[1].Version
+	}
+	if target == current {
+		return error_result(fmt.Sprintf("Version %d is already the current release", target))
+	}
+
+	resp, err := oper.client.Get(fmt.Sprintf("/heritages/%s/releases/%d", oper.heritage_name, target), nil)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	var rResp api.ReleaseResponse
+	err = json.Unmarshal(resp, &rResp)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if rResp.Release == nil || rResp.Release.Heritage == nil {
+		return error_result(fmt.Sprintf("Release %d has no heritage definition", target))
+	}
+
+	fmt.Fprintf(NoticeWriter(), "You are attempting to roll back %s from version %d to version %d\n", oper.heritage_name, current, target)
+	if !oper.no_confirm && !utils.AreYouSure("Are you sure?", oper.input_reader) {
+		return error_result("Aborted")
+	}
+
+	h := rResp.Release.Heritage
+	h.Name = oper.heritage_name
+	h.Version = 0
+	h.Token = ""
+	h.EnvVars = nil
+	h.District = nil
+	h.FillinDefaults()
+
+	j, err := json.Marshal(h)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	since := time.Now()
+	resp, err = oper.client.Patch("/heritages/"+oper.heritage_name, bytes.NewBuffer(j))
+	if err != nil {
+		return error_result(err.Error())
+	}
+	result := render(releaseRollbackResult{Heritage: oper.heritage_name, Version: target}, func(w io.Writer) {
+		fmt.Fprintf(w, "Rolled back %s to version %d\n", oper.heritage_name, target)
+	})
+	if result.is_error {
+		return result
+	}
+
+	if oper.wait {
+		var hResp api.HeritageResponse
+		err = json.Unmarshal(resp, &hResp)
+		if err != nil {
+			return error_result(err.Error())
+		}
+		if hResp.Heritage == nil {
+			return error_result("Barcelona didn't return the rolled back heritage")
+		}
+		return NewDeployWaitOperation(oper.client, hResp.Heritage, since, oper.timeout, NoticeWriter()).run()
+	}
+
+	return ok_result()
+}
+
+func (oper ReleaseOperation) run() *runResult {
+	if len(oper.heritage_name) == 0 {
+		return error_result("heritage name is required")
+	}
+
+	if oper.op_type == List {
+		return release_list(oper)
+	}
+
+	if oper.op_type == Rollback {
+		return release_rollback(oper)
+	}
+
+	return error_result("unknown operation")
+}
@@ -0,0 +1,103 @@
+package operations
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+type MockReleaseOperationApiClient struct {
+	patched string
+}
+
+func (client *MockReleaseOperationApiClient) Get(path string, body io.Reader) ([]byte, error) {
+	switch path {
+	case "/heritages/nginx/releases":
+		return bytes.NewBufferString(`{"releases":[
+			{"version":1,"image_tag":"v1","created_at":"2020-01-01T00:00:00Z","deployed_by":"alice"},
+			{"version":3,"image_tag":"v3","created_at":"2020-01-03T00:00:00Z","deployed_by":"carol"},
+			{"version":2,"heritage":{"image_tag":"v2"},"created_at":"2020-01-02T00:00:00Z","deployed_by":"bob"}
+		]}`).Bytes(), nil
+	case "/heritages/nginx/releases/2":
+		return bytes.NewBufferString(`{"release":{"version":2,"heritage":{"name":"nginx","image_name":"nginx","image_tag":"v2","version":2}}}`).Bytes(), nil
+	}
+	return bytes.NewBufferString(`{}`).Bytes(), nil
+}
+
+func (client *MockReleaseOperationApiClient) Patch(path string, body io.Reader) ([]byte, error) {
+	b, _ := ioutil.ReadAll(body)
+	client.patched = string(b)
+	return bytes.NewBufferString(`{}`).Bytes(), nil
+}
+
+func TestReleaseOperationReleasesSorted(t *testing.T) {
+	client := &MockReleaseOperationApiClient{}
+	oper := NewReleaseOperation("nginx", List, 0, false, false, 0, client, nil)
+
+	releases, err := oper.releases()
+	if err != nil {
+		t.Fatalf("Expected no error but got: %s", err)
+	}
+
+	for i, version := range []int{3, 2, 1} {
+		if releases[i].Version != version {
+			t.Errorf("Expected release %d to be version %d but got %d", i, version, releases[i].Version)
+		}
+	}
+
+	if releaseImageTag(releases[1]) != "v2" {
+		t.Errorf("Expected image tag to fall back to the heritage but got %s", releaseImageTag(releases[1]))
+	}
+}
+
+func ExampleReleaseOperation_run_rollback_confirm_n_output() {
+	client := &MockReleaseOperationApiClient{}
+	oper := NewReleaseOperation("nginx", Rollback, 0, false, false, 0, client, &MockAppOperationInputReaderNo{})
+
+	oper.run()
+	// Output:
+	// You are attempting to roll back nginx from version 3 to version 2
+	// Are you sure? [y/n]:
+}
+
+func TestReleaseOperationRollback(t *testing.T) {
+	client := &MockReleaseOperationApiClient{}
+	oper := NewReleaseOperation("nginx", Rollback, 0, true, false, 0, client, nil)
+
+	result := oper.run()
+	if result.is_error {
+		t.Fatalf("Expected no error but got: %s", result.message)
+	}
+
+	expected := `{"name":"nginx","image_name":"nginx","image_tag":"v2","before_deploy":null,"scheduled_tasks":[],"services":[],"environment":null}`
+	if client.patched != expected {
+		t.Errorf("Expected %s to be patched but got %s", expected, client.patched)
+	}
+}
+
+func TestReleaseOperationRollbackDeclined(t *testing.T) {
+	client := &MockReleaseOperationApiClient{}
+	oper := NewReleaseOperation("nginx", Rollback, 0, false, false, 0, client, &MockAppOperationInputReaderNo{})
+
+	result := oper.run()
+	if !result.is_error || result.message != "Aborted" {
+		t.Fatalf("Expected the rollback to be aborted but got %+v", result)
+	}
+	if len(client.patched) > 0 {
+		t.Errorf("Expected nothing to be patched")
+	}
+}
+
+func TestReleaseOperationRollbackToCurrent(t *testing.T) {
+	client := &MockReleaseOperationApiClient{}
+	oper := NewReleaseOperation("nginx", Rollback, 3, true, false, 0, client, nil)
+
+	result := oper.run()
+	if !result.is_error {
+		t.Fatalf("Expected an error")
+	}
+	if result.message != "Version 3 is already the current release" {
+		t.Errorf("Unexpected message: %s", result.message)
+	}
+}
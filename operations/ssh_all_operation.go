@@ -0,0 +1,224 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Limits which container instances SshAllOperation runs on. Empty
+// fields match every instance
+type SshAllFilter struct {
+	// ECS status, e.g. ACTIVE or DRAINING
+	Status string
+	// Private IPs, EC2 instance IDs or container instance ARNs
+	Instances []string
+}
+
+type SshAllOperation struct {
+	client        SshcmdOperationApiClient
+	districtName  string
+	command       string
+	filter        SshAllFilter
+	concurrency   int
+	config        utils.SshConfig
+	commandRunner utils.SshCommandRunner
+	// Output of the command on each instance, prefixed with its ID
+	out io.Writer
+}
+
+type sshAllResult struct {
+	Instance  string `json:"instance"`
+	PrivateIP string `json:"private_ip"`
+	// -1 when the command didn't run to completion
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+func NewSshAllOperation(
+	client SshcmdOperationApiClient,
+	districtName string,
+	command string,
+	filter SshAllFilter,
+	concurrency int,
+	config utils.SshConfig,
+	commandRunner utils.SshCommandRunner,
+	out io.Writer) *SshAllOperation {
+	return &SshAllOperation{
+		client:        client,
+		districtName:  districtName,
+		command:       command,
+		filter:        filter,
+		concurrency:   concurrency,
+		config:        config,
+		commandRunner: commandRunner,
+		out:           out,
+	}
+}
+
+func (oper SshAllOperation) run() *runResult {
+	if len(oper.districtName) == 0 {
+		return error_result("district name is required")
+	}
+	if len(strings.TrimSpace(oper.command)) == 0 {
+		return error_result("command is required")
+	}
+
+	resp, err := oper.client.Get("/districts/"+oper.districtName, nil)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	var districtResp api.DistrictResponse
+	err = json.Unmarshal(resp, &districtResp)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if districtResp.District == nil {
+		return error_result("No such district")
+	}
+
+	instances, err := filterContainerInstances(districtResp.District.ContainerInstances, oper.filter)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if len(instances) == 0 {
+		return error_result("No container instances matched")
+	}
+
+	// Every instance is reached with the same certificate
+	sign := func() (*utils.DistrictCertificate, error) {
+		return SignPublicKey(oper.client, oper.districtName)
+	}
+	var results []*sshAllResult
+	err = utils.NewCertCache(oper.config).Connect(oper.districtName, sign, func(cert *utils.DistrictCertificate) error {
+		results = oper.runAll(instances, cert)
+		return unreachableError(results)
+	})
+	if err != nil && results == nil {
+		return error_result(err.Error())
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			failed++
+		}
+	}
+
+	result := render(results, func(w io.Writer) {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Instance", "Private IP", "Exit Code", "Error"})
+		table.SetBorder(false)
+		for _, r := range results {
+			table.Append([]string{r.Instance, r.PrivateIP, strconv.Itoa(r.ExitCode), r.Error})
+		}
+		table.Render()
+	})
+	if result.is_error {
+		return result
+	}
+	if failed > 0 {
+		return error_result(fmt.Sprintf("The command failed on %d of %d instances", failed, len(results)))
+	}
+	return ok_result()
+}
+
+// An error when no instance could be connected to, which may be
+// because the bastion moved
+func unreachableError(results []*sshAllResult) error {
+	for _, r := range results {
+		if r.ExitCode != -1 && r.ExitCode != utils.SshErrorStatus {
+			return nil
+		}
+	}
+	return fmt.Errorf("Could not connect to any of %d instances", len(results))
+}
+
+func (oper SshAllOperation) runAll(instances []*api.ContainerInstance, cert *utils.DistrictCertificate) []*sshAllResult {
+	concurrency := oper.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*sshAllResult, len(instances))
+	var outLock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i, ci := range instances {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, ci *api.ContainerInstance) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			label := ci.EC2InstanceID
+			if len(label) == 0 {
+				label = ci.PrivateIPAddress
+			}
+			// The streams are copied concurrently and each has its own
+			// partial line
+			out := utils.NewPrefixWriter(oper.out, "["+label+"] ", &outLock)
+			defer out.Flush()
+			errOut := utils.NewPrefixWriter(oper.out, "["+label+"] ", &outLock)
+			defer errOut.Flush()
+
+			result := &sshAllResult{Instance: ci.EC2InstanceID, PrivateIP: ci.PrivateIPAddress}
+			results[i] = result
+
+			ssh := utils.NewSshCommandWithOptions(ci.PrivateIPAddress, cert, oper.config, oper.commandRunner, utils.SshOptions{
+				Stdout: out,
+				Stderr: errOut,
+			})
+			err := ssh.Run(oper.command)
+			if err == nil {
+				return
+			}
+			if code, ok := utils.ExitCode(err); ok {
+				result.ExitCode = code
+				return
+			}
+			result.ExitCode = -1
+			result.Error = err.Error()
+			// On its own line after whatever the remote side printed
+			errOut.Flush()
+			fmt.Fprintln(errOut, err)
+		}(i, ci)
+	}
+	wg.Wait()
+	return results
+}
+
+// Instances without a private IP can't be reached and are left out
+func filterContainerInstances(instances []*api.ContainerInstance, filter SshAllFilter) ([]*api.ContainerInstance, error) {
+	selected := map[*api.ContainerInstance]bool{}
+	for _, target := range filter.Instances {
+		ci, err := findContainerInstance(instances, target)
+		if err != nil {
+			return nil, err
+		}
+		selected[ci] = true
+	}
+
+	var matched []*api.ContainerInstance
+	for _, ci := range instances {
+		if len(ci.PrivateIPAddress) == 0 {
+			continue
+		}
+		if len(filter.Status) > 0 && !strings.EqualFold(ci.Status, filter.Status) {
+			continue
+		}
+		if len(filter.Instances) > 0 && !selected[ci] {
+			continue
+		}
+		matched = append(matched, ci)
+	}
+	return matched, nil
+}
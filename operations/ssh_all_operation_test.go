@@ -0,0 +1,104 @@
+package operations
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+)
+
+// Prints the instance it was run for and fails on 10.0.2.6
+type mockSshAllCommandRunner struct {
+	lock  sync.Mutex
+	certs map[string]bool
+}
+
+func (m *mockSshAllCommandRunner) RunCommand(name string, arg ...string) error {
+	return fmt.Errorf("expected streams")
+}
+
+func (m *mockSshAllCommandRunner) RunCommandWithStreams(stdin io.Reader, stdout io.Writer, stderr io.Writer, name string, arg ...string) error {
+	host := arg[len(arg)-2]
+	m.lock.Lock()
+	for _, a := range arg {
+		if strings.HasPrefix(a, "-oCertificateFile=") {
+			m.certs[a] = true
+		}
+	}
+	m.lock.Unlock()
+
+	fmt.Fprintf(stdout, "%s on %s\n", arg[len(arg)-1], host)
+	if host == "ec2-user@10.0.2.6" {
+		fmt.Fprint(stderr, "no space left")
+		return fmt.Errorf("connection closed")
+	}
+	return nil
+}
+
+func TestSshAllOperation(t *testing.T) {
+	dir := t.TempDir()
+
+	config := MockSshConfigOperationConfig{dir: dir, keyPath: testPrivateKey(dir)}
+	client := &MockSshConfigOperationApiClient{keyPath: config.keyPath, validBefore: time.Now().Add(time.Hour)}
+	runner := &mockSshAllCommandRunner{certs: map[string]bool{}}
+	var out bytes.Buffer
+	oper := NewSshAllOperation(client, "default", "df -h", SshAllFilter{}, 2, config, runner, &out)
+
+	result := oper.run()
+	if !result.is_error || result.message != "The command failed on 1 of 2 instances" {
+		t.Errorf("Expected one failure but got %+v", result)
+	}
+	if client.signed != 1 || len(runner.certs) != 1 {
+		t.Errorf("Expected one certificate for every instance but signed %d", client.signed)
+	}
+
+	output := out.String()
+	for _, line := range []string{
+		"[i-0123] df -h on ec2-user@10.0.1.5\n",
+		"[i-4567] df -h on ec2-user@10.0.2.6\n",
+		"[i-4567] no space left\n",
+		"[i-4567] connection closed\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in\n%s", line, output)
+		}
+	}
+}
+
+func TestFilterContainerInstances(t *testing.T) {
+	instances := []*api.ContainerInstance{
+		{EC2InstanceID: "i-0123", PrivateIPAddress: "10.0.1.5", Status: "ACTIVE"},
+		{EC2InstanceID: "i-4567", PrivateIPAddress: "10.0.2.6", Status: "DRAINING"},
+		{EC2InstanceID: "i-89ab", PrivateIPAddress: "10.0.3.7", Status: "ACTIVE"},
+		{EC2InstanceID: "i-cdef", Status: "ACTIVE"},
+	}
+	ids := func(filter SshAllFilter) string {
+		matched, err := filterContainerInstances(instances, filter)
+		if err != nil {
+			return err.Error()
+		}
+		var ids []string
+		for _, ci := range matched {
+			ids = append(ids, ci.EC2InstanceID)
+		}
+		return strings.Join(ids, " ")
+	}
+
+	cases := map[string]SshAllFilter{
+		"i-0123 i-4567 i-89ab": {},
+		"i-0123 i-89ab":        {Status: "active"},
+		"i-4567 i-89ab":        {Instances: []string{"10.0.3.7", "i-4567"}},
+		"i-89ab":               {Status: "ACTIVE", Instances: []string{"10.0.3.7", "i-4567"}},
+		"No container instance i-ffff in the district": {Instances: []string{"i-ffff"}},
+	}
+	for expected, filter := range cases {
+		if actual := ids(filter); actual != expected {
+			t.Errorf("%+v: expected %q but got %q", filter, expected, actual)
+		}
+	}
+}
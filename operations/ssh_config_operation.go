@@ -0,0 +1,255 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+)
+
+type SshConfigOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
+	Post(path string, body io.Reader) ([]byte, error)
+}
+
+type SshConfigOperationConfig interface {
+	utils.SshConfig
+	GetSshConfigPath() string
+}
+
+type SshConfigOperation struct {
+	client       SshConfigOperationApiClient
+	districtName string
+	write        bool
+	refresh      bool
+	config       SshConfigOperationConfig
+	certCache    *utils.CertCache
+}
+
+type sshConfigResult struct {
+	District        string     `json:"district"`
+	CertificateFile string     `json:"certificate_file"`
+	ValidUntil      *time.Time `json:"valid_until,omitempty"`
+	Signed          bool       `json:"signed"`
+	Path            string     `json:"path,omitempty"`
+	Hosts           []string   `json:"hosts,omitempty"`
+	Config          string     `json:"config,omitempty"`
+}
+
+func NewSshConfigOperation(
+	client SshConfigOperationApiClient,
+	districtName string,
+	write bool,
+	refresh bool,
+	config SshConfigOperationConfig) *SshConfigOperation {
+	return &SshConfigOperation{
+		client:       client,
+		districtName: districtName,
+		write:        write,
+		refresh:      refresh,
+		config:       config,
+		certCache:    utils.NewCertCache(config),
+	}
+}
+
+func (oper SshConfigOperation) run() *runResult {
+	if len(oper.districtName) == 0 {
+		return error_result("district name is required")
+	}
+
+	result := sshConfigResult{
+		District:        oper.districtName,
+		CertificateFile: oper.config.GetDistrictCertPath(oper.districtName),
+	}
+
+	// The cached certificate is only good enough for --refresh
+	var cert *utils.DistrictCertificate
+	var err error
+	if oper.refresh {
+		cert, err = oper.certCache.Get(oper.districtName, func() (*utils.DistrictCertificate, error) {
+			result.Signed = true
+			return oper.signPublicKey()
+		})
+	} else {
+		cert, err = oper.signPublicKey()
+		if err == nil {
+			result.Signed = true
+			cert, err = oper.certCache.Put(cert)
+		}
+	}
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if !cert.ValidBefore.IsZero() {
+		result.ValidUntil = &cert.ValidBefore
+	}
+
+	// ssh checks the hosts against bcn's known_hosts like bcn ssh does
+	knownHosts := &utils.KnownHosts{Path: oper.config.GetKnownHostsPath(), Out: os.Stderr}
+	if len(cert.HostCA) > 0 {
+		err = knownHosts.TrustAuthority(oper.districtName, cert.HostCA)
+		if err != nil {
+			return error_result(err.Error())
+		}
+	}
+
+	// --refresh alone only takes care of the certificate
+	if oper.refresh && !oper.write {
+		return render(result, func(w io.Writer) {
+			verb := "is"
+			if result.Signed {
+				verb = "has been signed and is"
+			}
+			if result.ValidUntil == nil {
+				fmt.Fprintf(w, "The certificate for %s %s valid\n", oper.districtName, verb)
+				return
+			}
+			fmt.Fprintf(w, "The certificate for %s %s valid until %s\n", oper.districtName, verb, result.ValidUntil.Format(time.RFC3339))
+		})
+	}
+
+	resp, err := oper.client.Get("/districts/"+oper.districtName, nil)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	var districtResp api.DistrictResponse
+	err = json.Unmarshal(resp, &districtResp)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	if districtResp.District == nil {
+		return error_result("No such district")
+	}
+
+	hosts, config := districtSshConfig(districtResp.District, oper.config.GetPrivateKeyPath(), result.CertificateFile, knownHosts)
+	result.Hosts = hosts
+
+	if !oper.write {
+		result.Config = config
+		return render(result, func(w io.Writer) {
+			fmt.Fprint(w, config)
+		})
+	}
+
+	result.Path = oper.config.GetSshConfigPath()
+	err = updateSshConfigFile(result.Path, oper.districtName, config)
+	if err != nil {
+		return error_result(err.Error())
+	}
+	return render(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Wrote %d hosts for %s to %s\n", len(hosts), oper.districtName, result.Path)
+		fmt.Fprintf(w, "Add this line at the top of ~/.ssh/config to use them:\n")
+		fmt.Fprintf(w, "  Include %s\n", sshConfigValue(result.Path))
+	})
+}
+
+func (oper SshConfigOperation) signPublicKey() (*utils.DistrictCertificate, error) {
+	return SignPublicKey(oper.client, oper.districtName)
+}
+
+// Quotes values with spaces, e.g. paths under a home directory with a
+// space in it
+func sshConfigValue(v string) string {
+	if strings.ContainsAny(v, " \t") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// Builds Host blocks for the district's bastion and for each container
+// instance by EC2 instance ID and private IP. Host keys are checked
+// against knownHosts the same way bcn ssh does. Returns the host names too
+func districtSshConfig(district *api.District, keyPath string, certPath string, knownHosts *utils.KnownHosts) ([]string, string) {
+	var b strings.Builder
+	var hosts []string
+	prefix := "bcn-" + district.Name + "-"
+	bastion := prefix + "bastion"
+
+	auth := func(alias string) {
+		fmt.Fprintf(&b, "  IdentityFile %s\n", sshConfigValue(keyPath))
+		fmt.Fprintf(&b, "  CertificateFile %s\n", sshConfigValue(certPath))
+		fmt.Fprintf(&b, "  IdentitiesOnly yes\n")
+		for _, option := range knownHosts.HostKeyOptions(district.Name, alias) {
+			fmt.Fprintf(&b, "  %s %s\n", option.Name, sshConfigValue(option.Value))
+		}
+		fmt.Fprintf(&b, "  LogLevel ERROR\n")
+		fmt.Fprintf(&b, "  ServerAliveInterval 60\n")
+		fmt.Fprintf(&b, "  ServerAliveCountMax 720\n")
+	}
+
+	fmt.Fprintf(&b, "# Generated by bcn ssh-config %s\n", district.Name)
+	fmt.Fprintf(&b, "Host %s\n", bastion)
+	fmt.Fprintf(&b, "  HostName %s\n", district.BastionIP)
+	fmt.Fprintf(&b, "  User hopper\n")
+	auth(utils.BastionHostKeyAlias(district.Name))
+	hosts = append(hosts, bastion)
+
+	for _, ci := range district.ContainerInstances {
+		if len(ci.PrivateIPAddress) == 0 {
+			continue
+		}
+		var names []string
+		if len(ci.EC2InstanceID) > 0 {
+			names = append(names, prefix+ci.EC2InstanceID)
+		}
+		names = append(names, prefix+ci.PrivateIPAddress)
+
+		fmt.Fprintf(&b, "\nHost %s\n", strings.Join(names, " "))
+		fmt.Fprintf(&b, "  HostName %s\n", ci.PrivateIPAddress)
+		fmt.Fprintf(&b, "  User ec2-user\n")
+		fmt.Fprintf(&b, "  ProxyJump %s\n", bastion)
+		auth(utils.HostKeyAlias(district.Name, ci.PrivateIPAddress))
+		hosts = append(hosts, names...)
+	}
+
+	return hosts, b.String()
+}
+
+func sshConfigMarkers(district string) (string, string) {
+	return "# BEGIN bcn " + district, "# END bcn " + district
+}
+
+// Replaces the district's section of the file, keeping the other
+// districts' sections and anything written by hand
+func updateSshConfigFile(path string, district string, config string) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	begin, end := sshConfigMarkers(district)
+	var lines []string
+	inSection := false
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
+		switch {
+		case line == begin:
+			inSection = true
+		case line == end:
+			inSection = false
+		case inSection:
+		case line == "" && len(lines) > 0 && lines[len(lines)-1] == "":
+			// Don't leave a gap where the section was
+		default:
+			lines = append(lines, line)
+		}
+	}
+
+	content := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if len(content) > 0 {
+		content += "\n\n"
+	}
+	content += begin + "\n" + config + end + "\n"
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(content), 0600)
+}
@@ -0,0 +1,272 @@
+package operations
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/degica/barcelona-cli/api"
+	"github.com/degica/barcelona-cli/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Writes a private key to dir and returns its path
+func testPrivateKey(dir string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "id_ecdsa")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+// Returns a certificate for the key at keyPath that expires at validBefore
+func testCertificate(keyPath string, validBefore time.Time) string {
+	keyBytes, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		panic(err)
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		panic(err)
+	}
+	cert := &ssh.Certificate{Key: signer.PublicKey(), CertType: ssh.UserCert, ValidBefore: uint64(validBefore.Unix())}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		panic(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert))
+}
+
+type MockSshConfigOperationApiClient struct {
+	keyPath     string
+	validBefore time.Time
+	signed      int
+}
+
+func (m *MockSshConfigOperationApiClient) Get(path string, body io.Reader) ([]byte, error) {
+	return []byte(`{"district":{"name":"default","bastion_ip":"1.2.3.4","container_instances":[
+		{"ec2_instance_id":"i-0123","private_ip_address":"10.0.1.5"},
+		{"ec2_instance_id":"i-4567","private_ip_address":"10.0.2.6"}
+	]}}`), nil
+}
+
+func (m *MockSshConfigOperationApiClient) Post(path string, body io.Reader) ([]byte, error) {
+	m.signed++
+	return json.Marshal(map[string]interface{}{
+		"district":    map[string]string{"name": "default", "bastion_ip": "1.2.3.4"},
+		"certificate": testCertificate(m.keyPath, m.validBefore),
+	})
+}
+
+type MockSshConfigOperationConfig struct {
+	dir     string
+	keyPath string
+}
+
+func (m MockSshConfigOperationConfig) GetPrivateKeyPath() string {
+	return m.keyPath
+}
+
+func (m MockSshConfigOperationConfig) IsDebug() bool {
+	return false
+}
+
+func (m MockSshConfigOperationConfig) UseNativeSsh() bool {
+	return false
+}
+
+func (m MockSshConfigOperationConfig) AcceptChangedHostKey() bool {
+	return false
+}
+
+func (m MockSshConfigOperationConfig) GetKnownHostsPath() string {
+	return filepath.Join(m.dir, "known_hosts")
+}
+
+func (m MockSshConfigOperationConfig) GetDistrictCertPath(district string) string {
+	return filepath.Join(m.dir, "certs", district+"-cert.pub")
+}
+
+func (m MockSshConfigOperationConfig) GetSshConfigPath() string {
+	return filepath.Join(m.dir, "ssh_config")
+}
+
+func Example_districtSshConfig() {
+	district := &api.District{
+		Name:      "default",
+		BastionIP: "1.2.3.4",
+		ContainerInstances: []*api.ContainerInstance{
+			{EC2InstanceID: "i-0123", PrivateIPAddress: "10.0.1.5"},
+		},
+	}
+	knownHosts := &utils.KnownHosts{Path: "/home/bcn/.bcn/known_hosts"}
+	hosts, config := districtSshConfig(district, "/home/bcn/.bcn/id_ecdsa", "/home/bcn/.bcn/certs/default-cert.pub", knownHosts)
+
+	fmt.Println(strings.Join(hosts, " "))
+	fmt.Print(config)
+	// Output:
+	// bcn-default-bastion bcn-default-i-0123 bcn-default-10.0.1.5
+	// # Generated by bcn ssh-config default
+	// Host bcn-default-bastion
+	//   HostName 1.2.3.4
+	//   User hopper
+	//   IdentityFile /home/bcn/.bcn/id_ecdsa
+	//   CertificateFile /home/bcn/.bcn/certs/default-cert.pub
+	//   IdentitiesOnly yes
+	//   HostKeyAlias bcn-default-bastion
+	//   UserKnownHostsFile /home/bcn/.bcn/known_hosts
+	//   StrictHostKeyChecking accept-new
+	//   LogLevel ERROR
+	//   ServerAliveInterval 60
+	//   ServerAliveCountMax 720
+	//
+	// Host bcn-default-i-0123 bcn-default-10.0.1.5
+	//   HostName 10.0.1.5
+	//   User ec2-user
+	//   ProxyJump bcn-default-bastion
+	//   IdentityFile /home/bcn/.bcn/id_ecdsa
+	//   CertificateFile /home/bcn/.bcn/certs/default-cert.pub
+	//   IdentitiesOnly yes
+	//   HostKeyAlias bcn-default-10.0.1.5
+	//   UserKnownHostsFile /home/bcn/.bcn/known_hosts
+	//   StrictHostKeyChecking accept-new
+	//   LogLevel ERROR
+	//   ServerAliveInterval 60
+	//   ServerAliveCountMax 720
+}
+
+func TestDistrictSshConfigHostCA(t *testing.T) {
+	dir := t.TempDir()
+	knownHosts := &utils.KnownHosts{Path: filepath.Join(dir, "known_hosts")}
+	keyBytes, err := ioutil.ReadFile(testPrivateKey(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = knownHosts.TrustAuthority("default", string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	district := &api.District{
+		Name:      "default",
+		BastionIP: "1.2.3.4",
+		ContainerInstances: []*api.ContainerInstance{
+			{EC2InstanceID: "i-0123", PrivateIPAddress: "10.0.1.5"},
+		},
+	}
+	_, config := districtSshConfig(district, "/home/bcn/.bcn/id_ecdsa", "/home/bcn/.bcn/certs/default-cert.pub", knownHosts)
+
+	// Host certificates are checked by address against the district's CA
+	if strings.Count(config, "  StrictHostKeyChecking yes\n") != 2 || strings.Contains(config, "accept-new") {
+		t.Errorf("Expected strict host key checking in\n%s", config)
+	}
+	if strings.Contains(config, "HostKeyAlias") {
+		t.Errorf("Unexpected HostKeyAlias in\n%s", config)
+	}
+	if !strings.Contains(config, "  UserKnownHostsFile "+knownHosts.Path+".default.ca\n") {
+		t.Errorf("Expected the district's CA file in\n%s", config)
+	}
+}
+
+func TestSshConfigOperationWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	config := MockSshConfigOperationConfig{dir: dir, keyPath: testPrivateKey(dir)}
+	handWritten := "Host github.com\n  User git\n"
+	err := ioutil.WriteFile(config.GetSshConfigPath(), []byte(handWritten), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &MockSshConfigOperationApiClient{keyPath: config.keyPath, validBefore: time.Now().Add(time.Hour)}
+	for _, district := range []string{"default", "staging", "default"} {
+		result := NewSshConfigOperation(client, district, true, false, config).run()
+		if result.is_error {
+			t.Fatalf("Unexpected error: %s", result.message)
+		}
+	}
+
+	b, err := ioutil.ReadFile(config.GetSshConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	if !strings.HasPrefix(content, handWritten+"\n# BEGIN bcn staging\n") {
+		t.Errorf("Expected the hand written hosts and then staging's section in\n%s", content)
+	}
+	if strings.Count(content, "# BEGIN bcn default\n") != 1 || !strings.HasSuffix(content, "# END bcn default\n") {
+		t.Errorf("Expected one section for default at the end in\n%s", content)
+	}
+	if strings.Contains(content, "\n\n\n") {
+		t.Errorf("Unexpected gap in\n%s", content)
+	}
+
+	cert, err := ioutil.ReadFile(config.GetDistrictCertPath("staging"))
+	if err != nil || !bytes.HasPrefix(cert, []byte("ecdsa-sha2-nistp256-cert-v01@openssh.com ")) {
+		t.Errorf("Expected a certificate for staging: %v", err)
+	}
+}
+
+func TestSshConfigOperationRefresh(t *testing.T) {
+	dir := t.TempDir()
+
+	config := MockSshConfigOperationConfig{dir: dir, keyPath: testPrivateKey(dir)}
+	client := &MockSshConfigOperationApiClient{keyPath: config.keyPath, validBefore: time.Now().Add(time.Hour)}
+	oper := NewSshConfigOperation(client, "default", false, true, config)
+
+	// No certificate yet, then a valid one
+	for i := 0; i < 2; i++ {
+		if result := oper.run(); result.is_error {
+			t.Fatalf("Unexpected error: %s", result.message)
+		}
+	}
+	if client.signed != 1 {
+		t.Errorf("Expected one signing but got %d", client.signed)
+	}
+
+	// Expired
+	client.validBefore = time.Now().Add(-time.Hour)
+	oper.certCache.Put(&utils.DistrictCertificate{
+		District:    "default",
+		BastionIP:   "1.2.3.4",
+		Certificate: testCertificate(config.keyPath, client.validBefore),
+	})
+	client.validBefore = time.Now().Add(time.Hour)
+	if result := oper.run(); result.is_error {
+		t.Fatalf("Unexpected error: %s", result.message)
+	}
+	if client.signed != 2 {
+		t.Errorf("Expected the expired certificate to be signed again")
+	}
+}
@@ -2,35 +2,68 @@ package operations
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/degica/barcelona-cli/api"
 	"github.com/degica/barcelona-cli/utils"
-	"io"
+	"github.com/olekukonko/tablewriter"
 )
 
 type SshcmdOperationApiClient interface {
+	Get(path string, body io.Reader) ([]byte, error)
 	Post(path string, body io.Reader) ([]byte, error)
 }
 
+// How to choose a container instance when none is given
+type InstanceChoice int
+
+const (
+	// Ask the user
+	PickInstance InstanceChoice = iota
+	RandomInstance
+	// The active instance with the fewest running and pending tasks
+	LeastLoadedInstance
+)
+
 type SshcmdOperation struct {
 	client        SshcmdOperationApiClient
 	districtName  string
-	ip            string
+	target        string
+	choice        InstanceChoice
 	config        utils.SshConfig
 	commandRunner utils.SshCommandRunner
+	inputReader   utils.UserInputReader
+	// The instance list and prompt go here
+	out  io.Writer
+	intn func(n int) int
 }
 
+// target is a private IP, an EC2 instance ID or a container instance
+// ARN. When it is empty choice decides which instance to connect to
 func NewSshcmdOperation(
 	client SshcmdOperationApiClient,
 	districtName string,
-	ip string,
+	target string,
+	choice InstanceChoice,
 	config utils.SshConfig,
-	commandRunner utils.SshCommandRunner) *SshcmdOperation {
+	commandRunner utils.SshCommandRunner,
+	inputReader utils.UserInputReader) *SshcmdOperation {
 	return &SshcmdOperation{
 		client:        client,
 		districtName:  districtName,
-		ip:            ip,
+		target:        target,
+		choice:        choice,
 		config:        config,
 		commandRunner: commandRunner,
+		inputReader:   inputReader,
+		out:           os.Stderr,
+		intn:          rand.Intn,
 	}
 }
 
@@ -38,31 +71,211 @@ func (oper SshcmdOperation) run() *runResult {
 	if len(oper.districtName) == 0 {
 		return error_result("district name is required")
 	}
-	if len(oper.ip) == 0 {
-		return error_result("ip is required")
+
+	ip, err := oper.instanceIP()
+	if err != nil {
+		return error_result(err.Error())
 	}
 
-	resp, err := oper.client.Post("/districts/"+oper.districtName+"/sign_public_key", nil)
+	sign := func() (*utils.DistrictCertificate, error) {
+		return SignPublicKey(oper.client, oper.districtName)
+	}
+	err = utils.NewCertCache(oper.config).Connect(oper.districtName, sign, func(cert *utils.DistrictCertificate) error {
+		ssh := utils.NewSshCommand(
+			ip,
+			cert,
+			oper.config,
+			oper.commandRunner,
+		)
+		return ssh.Run("")
+	})
 	if err != nil {
 		return error_result(err.Error())
 	}
+	return ok_result()
+}
+
+// An IP is used as is. Anything else needs the district's instances
+func (oper SshcmdOperation) instanceIP() (string, error) {
+	if net.ParseIP(oper.target) != nil {
+		return oper.target, nil
+	}
 
+	resp, err := oper.client.Get("/districts/"+oper.districtName, nil)
+	if err != nil {
+		return "", err
+	}
 	var districtResp api.DistrictResponse
 	err = json.Unmarshal(resp, &districtResp)
 	if err != nil {
-		return error_result(err.Error())
+		return "", err
+	}
+	if districtResp.District == nil {
+		return "", fmt.Errorf("No such district")
 	}
 
-	ssh := utils.NewSshCommand(
-		oper.ip,
-		districtResp.District.BastionIP,
-		districtResp.Certificate,
-		oper.config,
-		oper.commandRunner,
-	)
+	instance, err := oper.chooseInstance(districtResp.District.ContainerInstances)
+	if err != nil {
+		return "", err
+	}
+	if len(instance.PrivateIPAddress) == 0 {
+		return "", fmt.Errorf("%s has no private IP address", instance.EC2InstanceID)
+	}
+	return instance.PrivateIPAddress, nil
+}
 
-	if ssh.Run("") != nil {
-		return error_result(err.Error())
+func (oper SshcmdOperation) chooseInstance(instances []*api.ContainerInstance) (*api.ContainerInstance, error) {
+	if len(oper.target) > 0 {
+		return findContainerInstance(instances, oper.target)
 	}
-	return ok_result()
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("%s has no container instances", oper.districtName)
+	}
+
+	var instance *api.ContainerInstance
+	switch oper.choice {
+	case RandomInstance:
+		active := activeContainerInstances(instances)
+		if len(active) == 0 {
+			return nil, fmt.Errorf("%s has no active container instances", oper.districtName)
+		}
+		instance = active[oper.intn(len(active))]
+	case LeastLoadedInstance:
+		for _, ci := range activeContainerInstances(instances) {
+			if instance == nil || containerInstanceLoad(ci) < containerInstanceLoad(instance) {
+				instance = ci
+			}
+		}
+		if instance == nil {
+			return nil, fmt.Errorf("%s has no active container instances", oper.districtName)
+		}
+	default:
+		return oper.pickInstance(instances)
+	}
+
+	fmt.Fprintf(oper.out, "Connecting to %s (%s)\n", instance.EC2InstanceID, instance.PrivateIPAddress)
+	return instance, nil
+}
+
+// Lists the instances and asks for one by number, ID or IP
+func (oper SshcmdOperation) pickInstance(instances []*api.ContainerInstance) (*api.ContainerInstance, error) {
+	table := tablewriter.NewWriter(oper.out)
+	table.SetHeader([]string{"#", "Instance ID", "Private IP", "Status", "Running", "Pending"})
+	table.SetBorder(false)
+	for i, ci := range instances {
+		table.Append([]string{
+			strconv.Itoa(i + 1),
+			ci.EC2InstanceID,
+			ci.PrivateIPAddress,
+			ci.Status,
+			strconv.Itoa(ci.RunningTasksCount),
+			strconv.Itoa(ci.PendingTasksCount),
+		})
+	}
+	table.Render()
+
+	for {
+		fmt.Fprintf(oper.out, "Instance [1-%d]: ", len(instances))
+		answer, err := oper.inputReader.Read(false)
+		answer = strings.TrimSpace(answer)
+		if err != nil && len(answer) == 0 {
+			// e.g. stdin is not a terminal
+			return nil, fmt.Errorf("no instance chosen: %s", err)
+		}
+		if len(answer) == 0 {
+			continue
+		}
+
+		if n, convErr := strconv.Atoi(answer); convErr == nil {
+			if n >= 1 && n <= len(instances) {
+				return instances[n-1], nil
+			}
+		} else if ci, findErr := findContainerInstance(instances, answer); findErr == nil {
+			return ci, nil
+		}
+		fmt.Fprintf(oper.out, "No such instance: %s\n", answer)
+		if err != nil {
+			return nil, fmt.Errorf("no instance chosen")
+		}
+	}
+}
+
+// Finds an instance by private IP, EC2 instance ID, container instance
+// ARN or the ID at the end of the ARN
+func findContainerInstance(instances []*api.ContainerInstance, target string) (*api.ContainerInstance, error) {
+	for _, ci := range instances {
+		arnID := ci.ContainerInstanceArn[strings.LastIndex(ci.ContainerInstanceArn, "/")+1:]
+		switch target {
+		case ci.PrivateIPAddress, ci.EC2InstanceID, ci.ContainerInstanceArn, arnID:
+			if len(target) > 0 {
+				return ci, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No container instance %s in the district", target)
+}
+
+func activeContainerInstances(instances []*api.ContainerInstance) []*api.ContainerInstance {
+	var active []*api.ContainerInstance
+	for _, ci := range instances {
+		if ci.Status == "ACTIVE" && len(ci.PrivateIPAddress) > 0 {
+			active = append(active, ci)
+		}
+	}
+	return active
+}
+
+func containerInstanceLoad(ci *api.ContainerInstance) int {
+	return ci.RunningTasksCount + ci.PendingTasksCount
+}
+
+type PublicKeySigningClient interface {
+	Post(path string, body io.Reader) ([]byte, error)
+}
+
+// Has Barcelona sign our public key for the district. The result also
+// has the district's bastion IP and host CA
+func SignPublicKey(client PublicKeySigningClient, districtName string) (*utils.DistrictCertificate, error) {
+	resp, err := client.Post("/districts/"+districtName+"/sign_public_key", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var districtResp api.DistrictResponse
+	err = json.Unmarshal(resp, &districtResp)
+	if err != nil {
+		return nil, err
+	}
+	if districtResp.District == nil {
+		return nil, fmt.Errorf("No such district")
+	}
+	return &utils.DistrictCertificate{
+		District:    districtName,
+		BastionIP:   districtResp.District.BastionIP,
+		Certificate: districtResp.Certificate,
+		HostCA:      districtResp.HostCA,
+	}, nil
+}
+
+// The private IP of an instance of the district, found as
+// findContainerInstance does
+func containerInstanceIP(client SshcmdOperationApiClient, district string, target string) (string, error) {
+	resp, err := client.Get("/districts/"+district, nil)
+	if err != nil {
+		return "", err
+	}
+	var districtResp api.DistrictResponse
+	err = json.Unmarshal(resp, &districtResp)
+	if err != nil {
+		return "", err
+	}
+	if districtResp.District == nil {
+		return "", fmt.Errorf("No such district")
+	}
+
+	instance, err := findContainerInstance(districtResp.District.ContainerInstances, target)
+	if err != nil {
+		return "", err
+	}
+	return instance.PrivateIPAddress, nil
 }
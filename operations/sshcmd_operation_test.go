@@ -1,21 +1,37 @@
 package operations
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
 )
 
 type MockSshcmdOperationApiClient struct {
 }
 
+func (m MockSshcmdOperationApiClient) Get(path string, body io.Reader) ([]byte, error) {
+	return []byte(`{"district":{"name":"default","container_instances":[
+		{"container_instance_arn":"arn:aws:ecs:ap-northeast-1:123:container-instance/default/abc123","ec2_instance_id":"i-0123","private_ip_address":"10.0.1.5","status":"ACTIVE","running_tasks_count":4},
+		{"container_instance_arn":"arn:aws:ecs:ap-northeast-1:123:container-instance/default/def456","ec2_instance_id":"i-4567","private_ip_address":"10.0.2.6","status":"DRAINING","running_tasks_count":0},
+		{"container_instance_arn":"arn:aws:ecs:ap-northeast-1:123:container-instance/default/ghi789","ec2_instance_id":"i-89ab","private_ip_address":"10.0.3.7","status":"ACTIVE","running_tasks_count":1,"pending_tasks_count":1}
+	]}}`), nil
+}
+
 func (m MockSshcmdOperationApiClient) Post(path string, body io.Reader) ([]byte, error) {
 	return nil, nil
 }
 
 type MockSshcmdOperationConfig struct {
+	// Holds the certificates and known_hosts
+	dir string
 }
 
-func (m MockSshcmdOperationConfig) GetCertPath() string {
-	return ""
+func (m MockSshcmdOperationConfig) GetDistrictCertPath(district string) string {
+	return filepath.Join(m.dir, "certs", district+"-cert.pub")
 }
 
 func (m MockSshcmdOperationConfig) GetPrivateKeyPath() string {
@@ -26,6 +42,18 @@ func (m MockSshcmdOperationConfig) IsDebug() bool {
 	return false
 }
 
+func (m MockSshcmdOperationConfig) UseNativeSsh() bool {
+	return false
+}
+
+func (m MockSshcmdOperationConfig) AcceptChangedHostKey() bool {
+	return false
+}
+
+func (m MockSshcmdOperationConfig) GetKnownHostsPath() string {
+	return filepath.Join(m.dir, "known_hosts")
+}
+
 type MockSshcmdOperationCommandRunner struct {
 }
 
@@ -34,11 +62,93 @@ func (m MockSshcmdOperationCommandRunner) RunCommand(name string, arg ...string)
 }
 
 func ExampleSshcmdOperation_run_output() {
+	dir, _ := ioutil.TempDir("", "bcn")
+	defer os.RemoveAll(dir)
+
 	client := &MockSshcmdOperationApiClient{}
-	mockConfig := &MockSshcmdOperationConfig{}
+	mockConfig := &MockSshcmdOperationConfig{dir: dir}
 	mockCmdRunner := &MockSshcmdOperationCommandRunner{}
-	oper := NewSshcmdOperation(client, "asd", "123.123.123.123", mockConfig, mockCmdRunner)
+	oper := NewSshcmdOperation(client, "asd", "123.123.123.123", PickInstance, mockConfig, mockCmdRunner, nil)
 
 	oper.run()
 	// Output:
 }
+
+type mockInstanceAnswers struct {
+	answers []string
+}
+
+func (m *mockInstanceAnswers) Read(secret bool) (string, error) {
+	if len(m.answers) == 0 {
+		return "", io.EOF
+	}
+	answer := m.answers[0]
+	m.answers = m.answers[1:]
+	return answer + "\n", nil
+}
+
+func newTestSshcmdOperation(t *testing.T, target string, choice InstanceChoice, answers ...string) *SshcmdOperation {
+	oper := NewSshcmdOperation(MockSshcmdOperationApiClient{}, "default", target, choice, MockSshcmdOperationConfig{dir: t.TempDir()}, MockSshcmdOperationCommandRunner{}, &mockInstanceAnswers{answers: answers})
+	oper.out = ioutil.Discard
+	return oper
+}
+
+func TestSshcmdOperationInstanceIP(t *testing.T) {
+	cases := []struct {
+		target   string
+		choice   InstanceChoice
+		answers  []string
+		expected string
+	}{
+		{"10.9.9.9", PickInstance, nil, "10.9.9.9"},
+		{"i-4567", PickInstance, nil, "10.0.2.6"},
+		{"arn:aws:ecs:ap-northeast-1:123:container-instance/default/ghi789", PickInstance, nil, "10.0.3.7"},
+		{"abc123", PickInstance, nil, "10.0.1.5"},
+		{"", LeastLoadedInstance, nil, "10.0.3.7"},
+		{"", RandomInstance, nil, "10.0.3.7"},
+		{"", PickInstance, []string{"2"}, "10.0.2.6"},
+		{"", PickInstance, []string{"", "9", "i-89ab"}, "10.0.3.7"},
+	}
+
+	for _, c := range cases {
+		oper := newTestSshcmdOperation(t, c.target, c.choice, c.answers...)
+		// Always the last active instance
+		oper.intn = func(n int) int { return n - 1 }
+		ip, err := oper.instanceIP()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.target, err)
+			continue
+		}
+		if ip != c.expected {
+			t.Errorf("%q: expected %s but got %s", c.target, c.expected, ip)
+		}
+	}
+}
+
+func TestSshcmdOperationInstanceNotFound(t *testing.T) {
+	if _, err := newTestSshcmdOperation(t, "i-ffff", PickInstance).instanceIP(); err == nil {
+		t.Errorf("Expected an unknown instance to be an error")
+	}
+	// stdin closed before an instance was picked
+	if _, err := newTestSshcmdOperation(t, "", PickInstance).instanceIP(); err == nil {
+		t.Errorf("Expected no answer to be an error")
+	}
+}
+
+func TestSshcmdOperationPickInstanceList(t *testing.T) {
+	oper := newTestSshcmdOperation(t, "", PickInstance, "1")
+	var out bytes.Buffer
+	oper.out = &out
+	if _, err := oper.instanceIP(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, expected := range []string{"i-0123", "10.0.1.5", "i-4567", "DRAINING"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %s in the list\n%s", expected, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "Instance [1-3]: ") {
+		t.Errorf("Expected a prompt in\n%s", out.String())
+	}
+}
@@ -0,0 +1,132 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/degica/barcelona-cli/utils"
+)
+
+type TunnelOperationApiClient interface {
+	Post(path string, body io.Reader) ([]byte, error)
+}
+
+type TunnelOperation struct {
+	client       TunnelOperationApiClient
+	districtName string
+	local        string
+	// Empty for a SOCKS5 proxy
+	remote string
+	config utils.SshConfig
+	out    io.Writer
+}
+
+func NewTunnelOperation(
+	client TunnelOperationApiClient,
+	districtName string,
+	local string,
+	remote string,
+	config utils.SshConfig,
+	out io.Writer) *TunnelOperation {
+	return &TunnelOperation{
+		client:       client,
+		districtName: districtName,
+		local:        local,
+		remote:       remote,
+		config:       config,
+		out:          out,
+	}
+}
+
+func NewProxyOperation(
+	client TunnelOperationApiClient,
+	districtName string,
+	listen string,
+	config utils.SshConfig,
+	out io.Writer) *TunnelOperation {
+	return &TunnelOperation{
+		client:       client,
+		districtName: districtName,
+		local:        listen,
+		config:       config,
+		out:          out,
+	}
+}
+
+// A bare port listens on the loopback interface only
+func tunnelLocalAddr(local string) string {
+	if !strings.Contains(local, ":") {
+		return net.JoinHostPort("127.0.0.1", local)
+	}
+	return local
+}
+
+func (oper TunnelOperation) run() *runResult {
+	if len(oper.districtName) == 0 {
+		return error_result("district name is required")
+	}
+	socks := oper.remote == ""
+	if len(oper.local) == 0 {
+		return error_result("local port is required")
+	}
+	if _, _, err := net.SplitHostPort(oper.remote); !socks && err != nil {
+		return error_result("remote must be HOST:PORT")
+	}
+
+	listener, err := net.Listen("tcp", tunnelLocalAddr(oper.local))
+	if err != nil {
+		return error_result(err.Error())
+	}
+	defer listener.Close()
+
+	cache := utils.NewCertCache(oper.config)
+	source := func() (*utils.DistrictCertificate, error) {
+		return cache.Get(oper.districtName, oper.signPublicKey)
+	}
+	// The dialer reads the certificate Connect tried from the cache
+	var dialer *utils.RefreshingDialer
+	err = cache.Connect(oper.districtName, oper.signPublicKey, func(*utils.DistrictCertificate) error {
+		var dialErr error
+		dialer, dialErr = utils.NewRefreshingDialer(source, oper.config)
+		return dialErr
+	})
+	if err != nil {
+		return error_result(err.Error())
+	}
+	defer dialer.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if socks {
+		fmt.Fprintf(oper.out, "SOCKS5 proxy listening on %s through the %s bastion. Press Ctrl-C to stop\n", listener.Addr(), oper.districtName)
+	} else {
+		fmt.Fprintf(oper.out, "Forwarding %s to %s through the %s bastion. Press Ctrl-C to stop\n", listener.Addr(), oper.remote, oper.districtName)
+	}
+
+	tunnel := &utils.Tunnel{
+		Remote: oper.remote,
+		Dialer: dialer,
+		Out:    oper.out,
+		Debug:  oper.config.IsDebug(),
+	}
+	err = tunnel.Serve(ctx, listener)
+	if err != nil {
+		return error_result(err.Error())
+	}
+
+	fmt.Fprintln(oper.out, "Tunnel closed")
+	return ok_result()
+}
+
+// Signs our key the same way bcn ssh does. Called again whenever the
+// cached certificate is about to expire
+func (oper TunnelOperation) signPublicKey() (*utils.DistrictCertificate, error) {
+	return SignPublicKey(oper.client, oper.districtName)
+}
@@ -0,0 +1,60 @@
+package operations
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+type MockTunnelOperationApiClient struct {
+	posts int
+}
+
+func (m *MockTunnelOperationApiClient) Post(path string, body io.Reader) ([]byte, error) {
+	m.posts++
+	return nil, nil
+}
+
+func TestTunnelOperationRequiresArguments(t *testing.T) {
+	cases := []struct {
+		district, local, remote, message string
+	}{
+		{"", "5432", "db.internal:5432", "district name is required"},
+		{"default", "", "db.internal:5432", "local port is required"},
+		{"default", "5432", "db.internal", "remote must be HOST:PORT"},
+	}
+
+	for _, c := range cases {
+		client := &MockTunnelOperationApiClient{}
+		oper := NewTunnelOperation(client, c.district, c.local, c.remote, &MockSshcmdOperationConfig{dir: t.TempDir()}, ioutil.Discard)
+		result := oper.run()
+		if !result.is_error || result.message != c.message {
+			t.Errorf("Expected %q but got %+v", c.message, result)
+		}
+		if client.posts != 0 {
+			t.Errorf("Expected the key not to be signed")
+		}
+	}
+}
+
+func TestTunnelLocalAddr(t *testing.T) {
+	cases := map[string]string{
+		"5432":         "127.0.0.1:5432",
+		"0.0.0.0:5432": "0.0.0.0:5432",
+		":5432":        ":5432",
+	}
+	for local, expected := range cases {
+		if addr := tunnelLocalAddr(local); addr != expected {
+			t.Errorf("Expected %s but got %s", expected, addr)
+		}
+	}
+}
+
+func TestProxyOperationRequiresDistrict(t *testing.T) {
+	client := &MockTunnelOperationApiClient{}
+	oper := NewProxyOperation(client, "", "127.0.0.1:1080", &MockSshcmdOperationConfig{dir: t.TempDir()}, ioutil.Discard)
+	result := oper.run()
+	if !result.is_error || result.message != "district name is required" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
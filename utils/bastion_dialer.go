@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BastionDialer opens TCP connections from a district's bastion
+type BastionDialer interface {
+	Dial(addr string) (net.Conn, error)
+	Close() error
+}
+
+// Returns a dialer that uses the ssh binary or the native client like
+// SshCommand does
+func NewBastionDialer(cert *DistrictCertificate, sshConfig SshConfig) (BastionDialer, error) {
+	knownHosts, err := prepareKnownHosts(cert, sshConfig, BastionHostKeyAlias(cert.District))
+	if err != nil {
+		return nil, err
+	}
+	if !sshConfig.UseNativeSsh() {
+		return &systemBastionDialer{Certificate: cert, Config: sshConfig, KnownHosts: knownHosts}, nil
+	}
+
+	signer, err := certSigner(sshConfig.GetPrivateKeyPath(), cert.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	d := &nativeBastionDialer{
+		dialBastion: func() (bastionClient, error) {
+			return dialBastion(cert, signer, knownHosts)
+		},
+	}
+	err = d.connect()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Signs a fresh certificate for our key. The result has the bastion IP
+// and the district's host CA, if any, filled in
+type CertificateSigner func() (*DistrictCertificate, error)
+
+// Returns a certificate that is good for at least certRefreshMargin,
+// usually from a CertCache
+type CertificateSource func() (*DistrictCertificate, error)
+
+// Certificates are renewed this long before they expire
+const certRefreshMargin = 5 * time.Minute
+
+// RefreshingDialer gets a new certificate and switches to a new bastion
+// connection before the current certificate expires. Connections opened
+// earlier stay open, and their dialer is closed once they all are
+type RefreshingDialer struct {
+	source    CertificateSource
+	config    SshConfig
+	now       func() time.Time
+	newDialer func(cert *DistrictCertificate, sshConfig SshConfig) (BastionDialer, error)
+
+	lock      sync.Mutex
+	current   BastionDialer
+	expiresAt time.Time
+	// Dialers replaced by a newer one that still have open connections
+	retired map[BastionDialer]bool
+	// Number of open connections of each dialer
+	open map[BastionDialer]int
+}
+
+func NewRefreshingDialer(source CertificateSource, sshConfig SshConfig) (*RefreshingDialer, error) {
+	d := &RefreshingDialer{
+		source:    source,
+		config:    sshConfig,
+		now:       time.Now,
+		newDialer: NewBastionDialer,
+		retired:   map[BastionDialer]bool{},
+		open:      map[BastionDialer]int{},
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	err := d.refresh()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Must be called with the lock held
+func (d *RefreshingDialer) refresh() error {
+	cert, err := d.source()
+	if err != nil {
+		return err
+	}
+	dialer, err := d.newDialer(cert, d.config)
+	if err != nil {
+		return err
+	}
+
+	if d.current != nil {
+		if d.open[d.current] > 0 {
+			d.retired[d.current] = true
+		} else {
+			d.current.Close()
+		}
+	}
+	d.current = dialer
+	d.expiresAt = cert.ValidBefore
+
+	if d.config.IsDebug() && !cert.ValidBefore.IsZero() {
+		fmt.Printf("Using a certificate valid until %s\n", cert.ValidBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (d *RefreshingDialer) Dial(addr string) (net.Conn, error) {
+	d.lock.Lock()
+	if !d.expiresAt.IsZero() && d.now().Add(certRefreshMargin).After(d.expiresAt) {
+		err := d.refresh()
+		if err != nil {
+			d.lock.Unlock()
+			return nil, err
+		}
+	}
+	dialer := d.current
+	// Counted before dialing so the dialer isn't closed meanwhile
+	d.open[dialer]++
+	d.lock.Unlock()
+
+	conn, err := dialer.Dial(addr)
+	if err != nil {
+		d.release(dialer)
+		return nil, err
+	}
+	return &releasingConn{Conn: conn, release: func() { d.release(dialer) }}, nil
+}
+
+// Called when a connection of dialer was closed or could not be opened
+func (d *RefreshingDialer) release(dialer BastionDialer) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.open[dialer]--
+	if d.open[dialer] > 0 {
+		return
+	}
+	delete(d.open, dialer)
+	if d.retired[dialer] {
+		delete(d.retired, dialer)
+		dialer.Close()
+	}
+}
+
+func (d *RefreshingDialer) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for dialer := range d.retired {
+		dialer.Close()
+	}
+	d.retired = map[BastionDialer]bool{}
+	return d.current.Close()
+}
+
+// Calls release once when the connection is closed
+type releasingConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *releasingConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (c *releasingConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// The part of *ssh.Client nativeBastionDialer needs
+type bastionClient interface {
+	keepAliveClient
+	Dial(n string, addr string) (net.Conn, error)
+	Wait() error
+}
+
+// Keeps one connection to the bastion and opens a direct-tcpip channel
+// on it for every dial. The connection is made again when a dial finds
+// it lost, e.g. after keepalives went unanswered
+type nativeBastionDialer struct {
+	dialBastion func() (bastionClient, error)
+
+	lock   sync.Mutex
+	client bastionClient
+	// Closed once the connection of client has ended
+	lost chan struct{}
+	// Stops the keepalives of client
+	done chan struct{}
+}
+
+// Must be called with the lock held, or before the dialer is shared
+func (d *nativeBastionDialer) connect() error {
+	client, err := d.dialBastion()
+	if err != nil {
+		return err
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(lost)
+	}()
+	done := make(chan struct{})
+	go keepAlive(client, sshAliveInterval, sshAliveCountMax, done)
+
+	if d.done != nil {
+		close(d.done)
+	}
+	d.client, d.lost, d.done = client, lost, done
+	return nil
+}
+
+func (d *nativeBastionDialer) Dial(addr string) (net.Conn, error) {
+	d.lock.Lock()
+	client, lost := d.client, d.lost
+	d.lock.Unlock()
+
+	conn, err := client.Dial("tcp", addr)
+	if err == nil {
+		return conn, nil
+	}
+	select {
+	case <-lost:
+	default:
+		// The bastion is fine, addr could not be reached
+		return nil, err
+	}
+
+	d.lock.Lock()
+	err = nil
+	// Another dial may have reconnected already
+	if d.client == client {
+		err = d.connect()
+	}
+	client = d.client
+	d.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return client.Dial("tcp", addr)
+}
+
+func (d *nativeBastionDialer) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	close(d.done)
+	return d.client.Close()
+}
+
+// Runs ssh -W for every dial, the same way the ProxyCommand of
+// SshCommand reaches the instances
+type systemBastionDialer struct {
+	Certificate *DistrictCertificate
+	Config      SshConfig
+	KnownHosts  *KnownHosts
+}
+
+func (d *systemBastionDialer) Dial(addr string) (net.Conn, error) {
+	sshArgs := d.KnownHosts.sshOptions(d.Certificate.District, BastionHostKeyAlias(d.Certificate.District))
+	sshArgs = append(sshArgs,
+		"-oLogLevel=ERROR",
+		"-oServerAliveInterval=60",
+		"-oServerAliveCountMax=720", // 12 hours
+		"-i", d.Config.GetPrivateKeyPath(),
+		"-oCertificateFile="+d.Certificate.Path,
+		"-W", addr,
+		fmt.Sprintf("%s@%s", bastionUser, d.Certificate.BastionIP),
+	)
+	if d.Config.IsDebug() {
+		fmt.Printf("ssh %s\n", strings.Join(sshArgs, " "))
+	}
+
+	cmd := exec.Command("ssh", sshArgs...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout, addr: addr}, nil
+}
+
+func (d *systemBastionDialer) Close() error {
+	return nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command.
+// Deadlines are not supported
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	addr   string
+	once   sync.Once
+}
+
+type commandAddr string
+
+func (a commandAddr) Network() string { return "ssh" }
+func (a commandAddr) String() string  { return string(a) }
+
+func (c *commandConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c *commandConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Closing stdin makes ssh -W send EOF to the remote end
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return commandAddr("ssh") }
+func (c *commandConn) RemoteAddr() net.Addr               { return commandAddr(c.addr) }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns a certificate for a throwaway key that expires at validBefore
+func certificateValidBefore(t *testing.T, validBefore time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:         pub,
+		CertType:    ssh.UserCert,
+		ValidBefore: uint64(validBefore.Unix()),
+	}
+	err = cert.SignCert(rand.Reader, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert))
+}
+
+type recordingDialer struct {
+	cert   *DistrictCertificate
+	dialed []string
+	closed bool
+}
+
+func (d *recordingDialer) Dial(addr string) (net.Conn, error) {
+	d.dialed = append(d.dialed, addr)
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+func (d *recordingDialer) Close() error {
+	d.closed = true
+	return nil
+}
+
+func TestCertificateValidBefore(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	validBefore, err := CertificateValidBefore(certificateValidBefore(t, expiresAt))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !validBefore.Equal(expiresAt) {
+		t.Errorf("Expected %s but got %s", expiresAt, validBefore)
+	}
+
+	if _, err := CertificateValidBefore("ssh-ed25519 AAAA"); err == nil {
+		t.Errorf("Expected an error for an invalid certificate")
+	}
+}
+
+type testRefreshingDialer struct {
+	*RefreshingDialer
+	now     time.Time
+	signed  int
+	dialers []*recordingDialer
+}
+
+func newTestRefreshingDialer(t *testing.T) *testRefreshingDialer {
+	d := &testRefreshingDialer{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	d.RefreshingDialer = &RefreshingDialer{
+		source: func() (*DistrictCertificate, error) {
+			d.signed++
+			return &DistrictCertificate{BastionIP: "10.0.0.1", ValidBefore: d.now.Add(time.Hour)}, nil
+		},
+		config: mockNativeSshConfig{},
+		now:    func() time.Time { return d.now },
+		newDialer: func(cert *DistrictCertificate, sshConfig SshConfig) (BastionDialer, error) {
+			dialer := &recordingDialer{cert: cert}
+			d.dialers = append(d.dialers, dialer)
+			return dialer, nil
+		},
+		retired: map[BastionDialer]bool{},
+		open:    map[BastionDialer]int{},
+	}
+	if err := d.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRefreshingDialer(t *testing.T) {
+	d := newTestRefreshingDialer(t)
+
+	d.Dial("db.internal:5432")
+	if d.signed != 1 || len(d.dialers[0].dialed) != 1 {
+		t.Fatalf("Expected the first certificate to be used")
+	}
+
+	// Within the margin before expiry a new certificate is signed
+	d.now = d.now.Add(time.Hour - certRefreshMargin + time.Second)
+	d.Dial("db.internal:5432")
+	if d.signed != 2 || len(d.dialers) != 2 || len(d.dialers[1].dialed) != 1 {
+		t.Fatalf("Expected a new certificate to be signed")
+	}
+
+	d.Close()
+	if !d.dialers[0].closed || !d.dialers[1].closed {
+		t.Errorf("Expected every dialer to be closed")
+	}
+}
+
+func TestRefreshingDialerClosesDrainedDialers(t *testing.T) {
+	d := newTestRefreshingDialer(t)
+
+	conn, err := d.Dial("db.internal:5432")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.now = d.now.Add(time.Hour)
+	if _, err := d.Dial("db.internal:5432"); err != nil {
+		t.Fatal(err)
+	}
+	if d.dialers[0].closed {
+		t.Fatalf("Expected a dialer with open connections to stay open")
+	}
+
+	conn.Close()
+	conn.Close()
+	if !d.dialers[0].closed || d.dialers[1].closed {
+		t.Errorf("Expected only the retired dialer to be closed")
+	}
+	if len(d.retired) != 0 {
+		t.Errorf("Expected no retired dialers but got %d", len(d.retired))
+	}
+
+	// Without open connections a dialer is closed when it is replaced
+	d.now = d.now.Add(2 * time.Hour)
+	if _, err := d.Dial("db.internal:5432"); err != nil {
+		t.Fatal(err)
+	}
+	if d.dialers[1].closed {
+		t.Errorf("Expected the dialer with an open connection to stay open")
+	}
+}
+
+// A bastion connection that can be lost
+type fakeBastionClient struct {
+	lost   chan struct{}
+	once   sync.Once
+	dialed []string
+}
+
+func newFakeBastionClient() *fakeBastionClient {
+	return &fakeBastionClient{lost: make(chan struct{})}
+}
+
+func (c *fakeBastionClient) Dial(n string, addr string) (net.Conn, error) {
+	select {
+	case <-c.lost:
+		return nil, errors.New("ssh: connection closed")
+	default:
+	}
+	c.dialed = append(c.dialed, addr)
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+func (c *fakeBastionClient) Wait() error {
+	<-c.lost
+	return nil
+}
+
+func (c *fakeBastionClient) Close() error {
+	c.once.Do(func() { close(c.lost) })
+	return nil
+}
+
+func (c *fakeBastionClient) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	return true, nil, nil
+}
+
+func TestNativeBastionDialerReconnects(t *testing.T) {
+	var clients []*fakeBastionClient
+	d := &nativeBastionDialer{
+		dialBastion: func() (bastionClient, error) {
+			client := newFakeBastionClient()
+			clients = append(clients, client)
+			return client, nil
+		},
+	}
+	if err := d.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// e.g. closed by keepAlive
+	clients[0].Close()
+	select {
+	case <-d.lost:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the lost connection to be noticed")
+	}
+
+	if _, err := d.Dial("db.internal:5432"); err != nil {
+		t.Fatalf("Expected the dialer to reconnect but got %s", err)
+	}
+	if len(clients) != 2 || len(clients[1].dialed) != 1 {
+		t.Errorf("Expected the dial to go through a new connection")
+	}
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// How long to wait for another bcn that is signing the same district's
+// certificate
+const certLockTimeout = 30 * time.Second
+
+// DistrictCertificate is a certificate Barcelona signed for our key,
+// stored in the district's certificate file
+type DistrictCertificate struct {
+	District    string
+	BastionIP   string
+	Certificate string
+	Path        string
+	// Public key of the CA that signs the district's host keys. Empty
+	// when the district has none and host keys are pinned
+	HostCA string
+	// Zero for a certificate that never expires
+	ValidBefore time.Time
+}
+
+// Kept next to the certificate file since the certificate itself
+// doesn't say which bastion it is for
+type certCacheEntry struct {
+	BastionIP string `json:"bastion_ip"`
+	HostCA    string `json:"host_ca,omitempty"`
+}
+
+// CertCache keeps a certificate per district and only signs a new one
+// when ours is about to expire
+type CertCache struct {
+	config SshConfig
+	now    func() time.Time
+}
+
+func NewCertCache(sshConfig SshConfig) *CertCache {
+	return &CertCache{config: sshConfig, now: time.Now}
+}
+
+// Get returns the district's certificate, signing a new one when there
+// is none or it expires within certRefreshMargin
+func (c *CertCache) Get(district string, sign CertificateSigner) (*DistrictCertificate, error) {
+	cert, _, err := c.get(district, sign)
+	return cert, err
+}
+
+// Like Get. signed tells whether the certificate was signed just now
+func (c *CertCache) get(district string, sign CertificateSigner) (cert *DistrictCertificate, signed bool, err error) {
+	lock, err := c.lock(district)
+	if err != nil {
+		return nil, false, err
+	}
+	defer lock.Unlock()
+
+	cert, err = c.load(district)
+	if err == nil {
+		if c.config.IsDebug() {
+			fmt.Printf("Using the certificate in %s\n", cert.Path)
+		}
+		return cert, false, nil
+	}
+
+	cert, err = c.sign(district, sign)
+	return cert, err == nil, err
+}
+
+// Renew signs a new certificate for the district even when the one we
+// have is still good
+func (c *CertCache) Renew(district string, sign CertificateSigner) (*DistrictCertificate, error) {
+	lock, err := c.lock(district)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	return c.sign(district, sign)
+}
+
+// Connect calls connect with the district's certificate. The bastion IP
+// stored with a certificate goes stale when the bastion is replaced, so
+// when connect could not connect with a stored certificate a new one is
+// signed, and connect is called once more if its bastion IP differs
+func (c *CertCache) Connect(district string, sign CertificateSigner, connect func(cert *DistrictCertificate) error) error {
+	cert, signed, err := c.get(district, sign)
+	if err != nil {
+		return err
+	}
+	err = connect(cert)
+	if err == nil || signed || !isConnectionError(err) {
+		return err
+	}
+
+	renewed, renewErr := c.Renew(district, sign)
+	if renewErr != nil || renewed.BastionIP == cert.BastionIP {
+		return err
+	}
+	if c.config.IsDebug() {
+		fmt.Printf("The bastion of %s moved from %s to %s\n", district, cert.BastionIP, renewed.BastionIP)
+	}
+	return connect(renewed)
+}
+
+// Tells whether err may come from a connection that could not be made,
+// rather than from a remote command or a session that was lost
+func isConnectionError(err error) bool {
+	switch err.(type) {
+	case *SessionLostError, *HostKeyChangedError:
+		return false
+	}
+	if code, ok := ExitCode(err); ok {
+		return code == SshErrorStatus
+	}
+	return true
+}
+
+// Must be called with the district's lock held
+func (c *CertCache) sign(district string, sign CertificateSigner) (*DistrictCertificate, error) {
+	signed, err := sign()
+	if err != nil {
+		return nil, err
+	}
+	signed.District = district
+	return c.store(signed)
+}
+
+// Put stores a certificate that was signed along with something else,
+// e.g. a oneoff. Its District, BastionIP, Certificate and HostCA are used
+func (c *CertCache) Put(cert *DistrictCertificate) (*DistrictCertificate, error) {
+	lock, err := c.lock(cert.District)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	return c.store(cert)
+}
+
+func (c *CertCache) lock(district string) (*FileLock, error) {
+	path := c.config.GetDistrictCertPath(district)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	return LockFile(path+".lock", certLockTimeout)
+}
+
+// Reads the district's certificate. It is an error for it to be
+// missing, about to expire or for another key
+func (c *CertCache) load(district string) (*DistrictCertificate, error) {
+	path := c.config.GetDistrictCertPath(district)
+	certificate, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, err
+	}
+	var entry certCacheEntry
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return nil, err
+	}
+
+	validBefore, err := CertificateValidBefore(string(certificate))
+	if err != nil {
+		return nil, err
+	}
+	if !validBefore.IsZero() && !c.now().Add(certRefreshMargin).Before(validBefore) {
+		return nil, fmt.Errorf("certificate is about to expire")
+	}
+
+	// Switching profiles changes the key
+	matches, err := c.certificateForOurKey(string(certificate))
+	if err != nil {
+		return nil, err
+	}
+	if !matches {
+		return nil, fmt.Errorf("certificate is for another key")
+	}
+
+	return &DistrictCertificate{
+		District:    district,
+		BastionIP:   entry.BastionIP,
+		Certificate: string(certificate),
+		Path:        path,
+		HostCA:      entry.HostCA,
+		ValidBefore: validBefore,
+	}, nil
+}
+
+func (c *CertCache) certificateForOurKey(certificate string) (bool, error) {
+	keyBytes, err := ioutil.ReadFile(c.config.GetPrivateKeyPath())
+	if err != nil {
+		return false, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return false, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return false, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return false, fmt.Errorf("not an SSH certificate")
+	}
+	return bytes.Equal(cert.Key.Marshal(), signer.PublicKey().Marshal()), nil
+}
+
+// Must be called with the district's lock held
+func (c *CertCache) store(cert *DistrictCertificate) (*DistrictCertificate, error) {
+	validBefore, err := CertificateValidBefore(cert.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	path := c.config.GetDistrictCertPath(cert.District)
+	entry, err := json.Marshal(certCacheEntry{BastionIP: cert.BastionIP, HostCA: cert.HostCA})
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomically(path+".json", entry, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomically(path, []byte(cert.Certificate), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DistrictCertificate{
+		District:    cert.District,
+		BastionIP:   cert.BastionIP,
+		Certificate: cert.Certificate,
+		Path:        path,
+		HostCA:      cert.HostCA,
+		ValidBefore: validBefore,
+	}, nil
+}
+
+// Readers such as a running ssh never see a partly written file
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	err := ioutil.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
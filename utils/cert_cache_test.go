@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type mockCertCacheConfig struct {
+	dir     string
+	keyPath string
+}
+
+func (m mockCertCacheConfig) GetDistrictCertPath(district string) string {
+	return filepath.Join(m.dir, "certs", district+"-cert.pub")
+}
+func (m mockCertCacheConfig) GetKnownHostsPath() string {
+	return filepath.Join(m.dir, "known_hosts")
+}
+func (m mockCertCacheConfig) GetPrivateKeyPath() string  { return m.keyPath }
+func (m mockCertCacheConfig) IsDebug() bool              { return false }
+func (m mockCertCacheConfig) UseNativeSsh() bool         { return false }
+func (m mockCertCacheConfig) AcceptChangedHostKey() bool { return false }
+
+// Signs a certificate for the key at keyPath that expires at validBefore
+func signCertificate(t *testing.T, keyPath string, validBefore time.Time) string {
+	keyBytes, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:         signer.PublicKey(),
+		CertType:    ssh.UserCert,
+		ValidBefore: uint64(validBefore.Unix()),
+	}
+	err = cert.SignCert(rand.Reader, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert))
+}
+
+func newTestCertCache(t *testing.T) (*CertCache, string) {
+	dir := t.TempDir()
+	keyPath, _ := generateSignedKey(t, dir)
+	cache := NewCertCache(mockCertCacheConfig{dir: dir, keyPath: keyPath})
+	return cache, keyPath
+}
+
+func TestCertCacheReusesCertificate(t *testing.T) {
+	cache, keyPath := newTestCertCache(t)
+
+	now := time.Now()
+	signed := 0
+	sign := func() (*DistrictCertificate, error) {
+		signed++
+		return &DistrictCertificate{BastionIP: "1.2.3.4", Certificate: signCertificate(t, keyPath, now.Add(time.Hour)), HostCA: "ca"}, nil
+	}
+
+	first, err := cache.Get("default", sign)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	second, err := cache.Get("default", sign)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if signed != 1 {
+		t.Errorf("Expected one signing but got %d", signed)
+	}
+	if second.BastionIP != "1.2.3.4" || second.HostCA != "ca" || second.Certificate != first.Certificate || second.Path != first.Path {
+		t.Errorf("Expected the cached certificate but got %+v", second)
+	}
+
+	// Shortly before expiry a new one is signed
+	cache.now = func() time.Time { return now.Add(time.Hour - certRefreshMargin) }
+	if _, err := cache.Get("default", sign); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if signed != 2 {
+		t.Errorf("Expected the expiring certificate to be signed again")
+	}
+
+	// Other districts have their own
+	if _, err := cache.Get("staging", sign); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if signed != 3 {
+		t.Errorf("Expected a certificate for staging to be signed")
+	}
+}
+
+func TestCertCacheSignsForNewKey(t *testing.T) {
+	cache, keyPath := newTestCertCache(t)
+
+	otherKeyPath, _ := generateSignedKey(t, t.TempDir())
+
+	_, err := cache.Put(&DistrictCertificate{
+		District:    "default",
+		BastionIP:   "1.2.3.4",
+		Certificate: signCertificate(t, otherKeyPath, time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	signed := false
+	_, err = cache.Get("default", func() (*DistrictCertificate, error) {
+		signed = true
+		return &DistrictCertificate{BastionIP: "1.2.3.4", Certificate: signCertificate(t, keyPath, time.Now().Add(time.Hour))}, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !signed {
+		t.Errorf("Expected a certificate for another key not to be used")
+	}
+}
+
+func TestCertCacheConcurrentGet(t *testing.T) {
+	cache, keyPath := newTestCertCache(t)
+
+	var lock sync.Mutex
+	signed := 0
+	sign := func() (*DistrictCertificate, error) {
+		lock.Lock()
+		signed++
+		lock.Unlock()
+		return &DistrictCertificate{BastionIP: "1.2.3.4", Certificate: signCertificate(t, keyPath, time.Now().Add(time.Hour))}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get("default", sign); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if signed != 1 {
+		t.Errorf("Expected one signing but got %d", signed)
+	}
+}
+
+func TestCertCacheConnect(t *testing.T) {
+	cache, keyPath := newTestCertCache(t)
+
+	bastionIP := "1.2.3.4"
+	signed := 0
+	sign := func() (*DistrictCertificate, error) {
+		signed++
+		return &DistrictCertificate{BastionIP: bastionIP, Certificate: signCertificate(t, keyPath, time.Now().Add(time.Hour))}, nil
+	}
+	var connected []string
+	connect := func(cert *DistrictCertificate) error {
+		connected = append(connected, cert.BastionIP)
+		if cert.BastionIP != bastionIP {
+			return errors.New("could not connect to bastion")
+		}
+		return nil
+	}
+
+	if err := cache.Connect("default", sign, connect); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// The bastion was replaced after our certificate was stored
+	bastionIP = "5.6.7.8"
+	if err := cache.Connect("default", sign, connect); err != nil {
+		t.Fatalf("Expected a new certificate to be used but got %s", err)
+	}
+	if signed != 2 || strings.Join(connected, " ") != "1.2.3.4 1.2.3.4 5.6.7.8" {
+		t.Errorf("Unexpected connections %v after %d signings", connected, signed)
+	}
+
+	// Failures of the remote command don't need a new certificate
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	err := cache.Connect("default", sign, func(cert *DistrictCertificate) error { return exitErr })
+	if err != exitErr || signed != 2 {
+		t.Errorf("Expected the exit status without signing but got %v after %d signings", err, signed)
+	}
+
+	// Nor does a bastion that is just down
+	connected = nil
+	err = cache.Connect("default", sign, func(cert *DistrictCertificate) error {
+		connected = append(connected, cert.BastionIP)
+		return errors.New("could not connect to bastion")
+	})
+	if err == nil || signed != 3 || len(connected) != 1 {
+		t.Errorf("Expected one attempt but got %v", connected)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+
+	lock, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := LockFile(path, 0); err == nil {
+		t.Errorf("Expected the lock to be held")
+	}
+	lock.Unlock()
+
+	// A lock left behind by a crashed process
+	err = ioutil.WriteFile(path, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * fileLockStaleAfter)
+	os.Chtimes(path, old, old)
+	lock, err = LockFile(path, 0)
+	if err != nil {
+		t.Fatalf("Expected the stale lock to be taken over: %s", err)
+	}
+	lock.Unlock()
+}
+
+func TestBreakStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+
+	// Another bcn broke the stale lock and took it before we got to it
+	if err := ioutil.WriteFile(path, []byte("2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	breakStaleLock(path)
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "2\n" {
+		t.Fatalf("Expected the live lock to be kept but got %q, %v", b, err)
+	}
+
+	old := time.Now().Add(-2 * fileLockStaleAfter)
+	os.Chtimes(path, old, old)
+	breakStaleLock(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale lock to be removed")
+	}
+	if matches, _ := filepath.Glob(path + ".*"); len(matches) > 0 {
+		t.Errorf("Unexpected files %v", matches)
+	}
+}
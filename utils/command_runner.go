@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"os"
 	"os/exec"
 )
@@ -15,3 +16,11 @@ func (cr CommandRunner) RunCommand(name string, arg ...string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+func (cr CommandRunner) RunCommandWithStreams(stdin io.Reader, stdout io.Writer, stderr io.Writer, name string, arg ...string) error {
+	cmd := exec.Command(name, arg...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DotenvError points at the line of an env file that could not be parsed
+type DotenvError struct {
+	Line    int
+	Message string
+}
+
+func (e DotenvError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func LoadDotenvFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := ParseDotenv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return vars, nil
+}
+
+// ParseDotenv reads KEY=VALUE lines as written for dotenv tools:
+//
+//   - blank lines and lines starting with # are ignored
+//   - an "export " prefix is allowed
+//   - unquoted values are trimmed and end at a " #" comment
+//   - single quoted values are taken literally
+//   - double quoted values understand \n, \r, \t, \", \\ and \$
+//   - quoted values may span several lines
+//
+// Later definitions of a key win
+func ParseDotenv(data string) (map[string]string, error) {
+	p := &dotenvParser{data: strings.Replace(data, "\r\n", "\n", -1), line: 1}
+	vars := map[string]string{}
+
+	for {
+		p.skipBlankAndComments()
+		if p.eof() {
+			return vars, nil
+		}
+
+		line := p.line
+		key, value, err := p.parseAssignment()
+		if err != nil {
+			return nil, err
+		}
+		if !dotenvKeyPattern.MatchString(key) {
+			return nil, DotenvError{line, fmt.Sprintf("invalid variable name %q", key)}
+		}
+		vars[key] = value
+	}
+}
+
+type dotenvParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *dotenvParser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *dotenvParser) peek() byte {
+	return p.data[p.pos]
+}
+
+func (p *dotenvParser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *dotenvParser) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+// Skips to the start of the next line
+func (p *dotenvParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *dotenvParser) skipBlankAndComments() {
+	for !p.eof() {
+		p.skipSpaces()
+		if p.eof() {
+			return
+		}
+		switch p.peek() {
+		case '\n':
+			p.next()
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *dotenvParser) parseAssignment() (string, string, error) {
+	line := p.line
+	start := p.pos
+	for !p.eof() && p.peek() != '=' && p.peek() != '\n' {
+		p.next()
+	}
+	if p.eof() || p.peek() != '=' {
+		return "", "", DotenvError{line, "expected KEY=VALUE"}
+	}
+	key := strings.TrimSpace(p.data[start:p.pos])
+	if strings.HasPrefix(key, "export ") || strings.HasPrefix(key, "export\t") {
+		key = strings.TrimSpace(key[len("export"):])
+	}
+	p.next() // =
+
+	p.skipSpaces()
+	if p.eof() {
+		return key, "", nil
+	}
+
+	var value string
+	var err error
+	switch p.peek() {
+	case '\'':
+		value, err = p.parseSingleQuoted()
+	case '"':
+		value, err = p.parseDoubleQuoted()
+	default:
+		return key, p.parseUnquoted(), nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// Only a comment may follow a quoted value
+	p.skipSpaces()
+	if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+		return "", "", DotenvError{p.line, fmt.Sprintf("unexpected characters after the value of %s", key)}
+	}
+	p.skipLine()
+	return key, value, nil
+}
+
+func (p *dotenvParser) parseUnquoted() string {
+	start := p.pos
+	end := p.pos
+	for !p.eof() && p.peek() != '\n' {
+		if p.peek() == '#' && p.pos > start && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
+		}
+		p.next()
+		end = p.pos
+	}
+	p.skipLine()
+	return strings.TrimSpace(p.data[start:end])
+}
+
+func (p *dotenvParser) parseSingleQuoted() (string, error) {
+	line := p.line
+	p.next() // '
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		return "", DotenvError{line, "unterminated single quoted value"}
+	}
+	value := p.data[start:p.pos]
+	p.next() // '
+	return value, nil
+}
+
+func (p *dotenvParser) parseDoubleQuoted() (string, error) {
+	line := p.line
+	p.next() // "
+	var b strings.Builder
+	for !p.eof() {
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				break
+			}
+			e := p.next()
+			switch e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", DotenvError{line, "unterminated double quoted value"}
+}
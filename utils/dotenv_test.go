@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	data := `# comment
+PLAIN=value
+SPACED = spaced value  
+export EXPORTED=yes
+COMMENTED=abc # trailing comment
+HASH=abc#def
+EMPTY=
+SINGLE='literal $HOME \n'
+DOUBLE="line1\nline2 \"quoted\" \$HOME"
+MULTI="first
+second"
+MULTI_SINGLE='a
+b' # comment
+lower_case1=ok
+WINDOWS=crlf` + "\r\n"
+
+	vars, err := ParseDotenv(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":        "value",
+		"SPACED":       "spaced value",
+		"EXPORTED":     "yes",
+		"COMMENTED":    "abc",
+		"HASH":         "abc#def",
+		"EMPTY":        "",
+		"SINGLE":       `literal $HOME \n`,
+		"DOUBLE":       "line1\nline2 \"quoted\" $HOME",
+		"MULTI":        "first\nsecond",
+		"MULTI_SINGLE": "a\nb",
+		"lower_case1":  "ok",
+		"WINDOWS":      "crlf",
+	}
+	for k, v := range expected {
+		if vars[k] != v {
+			t.Errorf("Expected %s to be %q but got %q", k, v, vars[k])
+		}
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	cases := map[string]string{
+		"A=1\nNOVALUE\n":       "line 2: expected KEY=VALUE",
+		"1ABC=def":             `line 1: invalid variable name "1ABC"`,
+		"A=1\nB=\"open\n":      "line 2: unterminated double quoted value",
+		"A='open":              "line 1: unterminated single quoted value",
+		"A=\"quoted\" garbage": "line 1: unexpected characters after the value of A",
+	}
+	for data, message := range cases {
+		_, err := ParseDotenv(data)
+		if err == nil {
+			t.Errorf("Expected an error for %q", data)
+			continue
+		}
+		if err.Error() != message {
+			t.Errorf("Expected %q for %q but got %q", message, data, err.Error())
+		}
+	}
+}
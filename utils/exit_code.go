@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os/exec"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Returns the exit status of the process or remote command that err
+// came from. ok is false when err is not an exit status at all, e.g.
+// when the connection could not be made
+func ExitCode(err error) (code int, ok bool) {
+	switch e := err.(type) {
+	case *exec.ExitError:
+		return e.ExitCode(), true
+	case *ssh.ExitError:
+		return e.ExitStatus(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	code, ok := ExitCode(err)
+	if !ok || code != 3 {
+		t.Errorf("Expected exit code 3 but got %d (%t)", code, ok)
+	}
+
+	_, ok = ExitCode(errors.New("connection refused"))
+	if ok {
+		t.Errorf("Expected a plain error not to have an exit code")
+	}
+}
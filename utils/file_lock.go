@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// A lock file older than this was left behind by a bcn that died
+// while holding it
+const fileLockStaleAfter = 2 * time.Minute
+
+var fileLockRetryInterval = 100 * time.Millisecond
+
+// FileLock is held by creating its file exclusively, which behaves the
+// same on every platform and across processes
+type FileLock struct {
+	path string
+}
+
+// LockFile waits up to timeout for the lock at path
+func LockFile(path string, timeout time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return &FileLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > fileLockStaleAfter {
+			breakStaleLock(path)
+			continue
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock %s. Remove it if no other bcn is running", path)
+		}
+		time.Sleep(fileLockRetryInterval)
+	}
+}
+
+// Removes a lock left behind. Several bcns may find the same lock stale,
+// and by the time one removes it another may have taken it again. So it
+// is renamed away first and only removed when it is still stale
+func breakStaleLock(path string) {
+	tmp := fmt.Sprintf("%s.%d.stale", path, os.Getpid())
+	if os.Rename(path, tmp) != nil {
+		// Someone else got to it
+		return
+	}
+	info, err := os.Stat(tmp)
+	if err == nil && time.Since(info.ModTime()) <= fileLockStaleAfter {
+		// A live lock. Put it back unless it was taken meanwhile
+		os.Link(tmp, path)
+	}
+	os.Remove(tmp)
+}
+
+func (l *FileLock) Unlock() error {
+	return os.Remove(l.path)
+}
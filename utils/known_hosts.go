@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host keys are pinned under an alias rather than the IP so that the
+// same private IP in two districts doesn't share a key
+func HostKeyAlias(district string, ip string) string {
+	return "bcn-" + district + "-" + ip
+}
+
+func BastionHostKeyAlias(district string) string {
+	return "bcn-" + district + "-bastion"
+}
+
+// KnownHosts is bcn's own known_hosts file. Hosts of a district whose
+// host CA Barcelona told us about are trusted through the CA. Others are
+// pinned the first time we connect and must keep their key
+type KnownHosts struct {
+	Path string
+	// Warnings are written here
+	Out io.Writer
+}
+
+// Sets up the known_hosts file for connecting to the given aliases of
+// the certificate's district. With AcceptChangedHostKey their pinned
+// keys are forgotten first
+func prepareKnownHosts(cert *DistrictCertificate, sshConfig SshConfig, aliases ...string) (*KnownHosts, error) {
+	k := &KnownHosts{Path: sshConfig.GetKnownHostsPath(), Out: os.Stderr}
+
+	err := os.MkdirAll(filepath.Dir(k.Path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(k.Path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	if len(cert.HostCA) > 0 {
+		err = k.TrustAuthority(cert.District, cert.HostCA)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if sshConfig.AcceptChangedHostKey() {
+		err = k.Forget(aliases...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Replaces the lines of the file for which drop returns true and
+// appends add when it isn't empty
+func (k *KnownHosts) update(drop func(fields []string) bool, add string) error {
+	lock, err := LockFile(k.Path+".lock", certLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	b, err := ioutil.ReadFile(k.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if len(line) == 0 || drop(strings.Fields(line)) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(add) > 0 {
+		lines = append(lines, add)
+	}
+
+	content := strings.Join(lines, "\n")
+	if len(content) > 0 {
+		content += "\n"
+	}
+	return writeFileAtomically(k.Path, []byte(content), 0600)
+}
+
+// The host CA of a district is kept in a known_hosts file of its own
+// that is only consulted for the district's hosts. Host certificates name
+// hosts by their address, so a pattern in the shared file couldn't tell a
+// private IP in one district from the same IP in another
+func (k *KnownHosts) authorityPath(district string) string {
+	return k.Path + "." + district + ".ca"
+}
+
+// TrustAuthority makes the district's hosts trusted when they present a
+// certificate signed by ca, replacing a CA trusted before
+func (k *KnownHosts) TrustAuthority(district string, ca string) error {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(ca))
+	if err != nil {
+		return fmt.Errorf("invalid host CA for %s: %s", district, err)
+	}
+	line := "@cert-authority * " + string(ssh.MarshalAuthorizedKey(key))
+	return writeFileAtomically(k.authorityPath(district), []byte(line), 0600)
+}
+
+// Forget removes the keys pinned for the aliases
+func (k *KnownHosts) Forget(aliases ...string) error {
+	forget := map[string]bool{}
+	for _, alias := range aliases {
+		forget[alias] = true
+	}
+
+	return k.update(func(fields []string) bool {
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "@") {
+			return false
+		}
+		for _, host := range strings.Split(fields[0], ",") {
+			if forget[host] {
+				fmt.Fprintf(k.Out, "Forgetting the host key of %s\n", host)
+				return true
+			}
+		}
+		return false
+	}, "")
+}
+
+func (k *KnownHosts) pin(alias string, key ssh.PublicKey) error {
+	return k.update(func(fields []string) bool { return false }, knownhosts.Line([]string{alias}, key))
+}
+
+// authority returns the host CA of the district or nil when it has none
+func (k *KnownHosts) authority(district string) ssh.PublicKey {
+	b, err := ioutil.ReadFile(k.authorityPath(district))
+	if err != nil {
+		return nil
+	}
+	marker, _, key, _, _, err := ssh.ParseKnownHosts(b)
+	if err != nil || marker != "cert-authority" {
+		return nil
+	}
+	return key
+}
+
+// hasAuthority tells whether the district has a host CA, in which case
+// hosts may present certificates
+func (k *KnownHosts) hasAuthority(district string) bool {
+	return k.authority(district) != nil
+}
+
+// HostKeyChangedError is returned when a host presents another key than
+// the one pinned for it
+type HostKeyChangedError struct {
+	Alias string
+	Path  string
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf(`WARNING: THE HOST KEY OF %s HAS CHANGED!
+Someone could be intercepting the connection, or the host has been replaced.
+The key pinned for it is in %s. Refusing to connect.
+If you are sure the host was replaced, run again with --accept-changed-host-key`, e.Alias, e.Path)
+}
+
+// Callback verifies the host known under alias for the native client.
+// Unknown hosts are pinned on first use unless the district has a host
+// CA, whose hosts must present a certificate signed by it for the
+// address we connect to
+func (k *KnownHosts) Callback(district string, alias string) (ssh.HostKeyCallback, error) {
+	check, err := knownhosts.New(k.Path)
+	if err != nil {
+		return nil, err
+	}
+	ca := k.authority(district)
+	authority := ca != nil
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if cert, ok := key.(*ssh.Certificate); ok && authority {
+			checker := &ssh.CertChecker{
+				IsHostAuthority: func(auth ssh.PublicKey, address string) bool {
+					return bytes.Equal(auth.Marshal(), ca.Marshal())
+				},
+			}
+			if err := checker.CheckHostKey(hostname, remote, cert); err != nil {
+				return fmt.Errorf("the host certificate of %s was refused: %s", alias, err)
+			}
+			return nil
+		}
+
+		err := check(net.JoinHostPort(alias, sshPort), remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return &HostKeyChangedError{Alias: alias, Path: k.Path}
+		}
+		if authority {
+			return fmt.Errorf("%s did not present a host certificate signed by the host CA of %s. Refusing to connect", alias, district)
+		}
+
+		fmt.Fprintf(k.Out, "Pinned the %s host key of %s (%s) in %s\n", key.Type(), alias, ssh.FingerprintSHA256(key), k.Path)
+		return k.pin(alias, key)
+	}, nil
+}
+
+// SshOption is an option of the ssh binary as it is named in ssh_config
+type SshOption struct {
+	Name  string
+	Value string
+}
+
+// HostKeyOptions are the ssh options that check the host known under
+// alias the same way. ssh checks the principals of a certificate against
+// HostKeyAlias, so hosts of a district with a host CA are checked under
+// their address against the district's CA only
+func (k *KnownHosts) HostKeyOptions(district string, alias string) []SshOption {
+	if k.hasAuthority(district) {
+		return []SshOption{
+			{"UserKnownHostsFile", k.authorityPath(district)},
+			{"StrictHostKeyChecking", "yes"},
+		}
+	}
+	return []SshOption{
+		{"HostKeyAlias", alias},
+		{"UserKnownHostsFile", k.Path},
+		{"StrictHostKeyChecking", "accept-new"},
+	}
+}
+
+// HostKeyOptions as arguments of the ssh binary
+func (k *KnownHosts) sshOptions(district string, alias string) []string {
+	var args []string
+	for _, option := range k.HostKeyOptions(district, alias) {
+		args = append(args, "-o"+option.Name+"="+option.Value)
+	}
+	return args
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type mockKnownHostsConfig struct {
+	mockCertCacheConfig
+	acceptChanged bool
+}
+
+func (m mockKnownHostsConfig) AcceptChangedHostKey() bool { return m.acceptChanged }
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func checkHostKey(t *testing.T, k *KnownHosts, alias string, key ssh.PublicKey) error {
+	callback, err := k.Callback("default", alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback("10.0.0.1:22", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}, key)
+}
+
+func newTestKnownHosts(t *testing.T, acceptChanged bool) (*KnownHosts, mockKnownHostsConfig) {
+	config := mockKnownHostsConfig{mockCertCacheConfig: mockCertCacheConfig{dir: t.TempDir()}, acceptChanged: acceptChanged}
+	k, err := prepareKnownHosts(&DistrictCertificate{District: "default"}, config, HostKeyAlias("default", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Out = ioutil.Discard
+	return k, config
+}
+
+func TestKnownHostsPinsOnFirstUse(t *testing.T) {
+	k, _ := newTestKnownHosts(t, false)
+
+	alias := HostKeyAlias("default", "10.0.0.1")
+	hostKey := newTestSigner(t).PublicKey()
+	if err := checkHostKey(t, k, alias, hostKey); err != nil {
+		t.Fatalf("Expected an unknown host to be pinned but got %s", err)
+	}
+	if err := checkHostKey(t, k, alias, hostKey); err != nil {
+		t.Fatalf("Expected the pinned key to be accepted but got %s", err)
+	}
+
+	// The same IP in another district is another host
+	if err := checkHostKey(t, k, HostKeyAlias("staging", "10.0.0.1"), newTestSigner(t).PublicKey()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	err := checkHostKey(t, k, alias, newTestSigner(t).PublicKey())
+	if _, ok := err.(*HostKeyChangedError); !ok {
+		t.Fatalf("Expected a changed key to be refused but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "--accept-changed-host-key") {
+		t.Errorf("Expected the error to mention the override in %s", err)
+	}
+}
+
+func TestKnownHostsAcceptChangedHostKey(t *testing.T) {
+	k, config := newTestKnownHosts(t, false)
+
+	alias := HostKeyAlias("default", "10.0.0.1")
+	other := HostKeyAlias("default", "10.0.0.2")
+	checkHostKey(t, k, alias, newTestSigner(t).PublicKey())
+	otherKey := newTestSigner(t).PublicKey()
+	checkHostKey(t, k, other, otherKey)
+
+	config.acceptChanged = true
+	k, err := prepareKnownHosts(&DistrictCertificate{District: "default"}, config, alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Out = ioutil.Discard
+
+	if err := checkHostKey(t, k, alias, newTestSigner(t).PublicKey()); err != nil {
+		t.Errorf("Expected the new key to be accepted but got %s", err)
+	}
+	if err := checkHostKey(t, k, other, otherKey); err != nil {
+		t.Errorf("Expected other hosts to keep their key but got %s", err)
+	}
+}
+
+func TestKnownHostsAuthority(t *testing.T) {
+	k, _ := newTestKnownHosts(t, false)
+
+	ca := newTestSigner(t)
+	caLine := string(ssh.MarshalAuthorizedKey(ca.PublicKey()))
+	if err := k.TrustAuthority("default", caLine); err != nil {
+		t.Fatal(err)
+	}
+	// A rotated CA replaces the old one
+	if err := k.TrustAuthority("default", caLine); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(k.Path + ".default.ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(b), "@cert-authority * ") != 1 {
+		t.Errorf("Expected one CA line in\n%s", b)
+	}
+	if !k.hasAuthority("default") || k.hasAuthority("staging") {
+		t.Errorf("Expected only default to have a host CA")
+	}
+
+	// Certificates name the host by its address
+	alias := HostKeyAlias("default", "10.0.0.1")
+	cert := &ssh.Certificate{
+		Key:             newTestSigner(t).PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"10.0.0.1", "ip-10-0-0-1.ec2.internal"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHostKey(t, k, alias, cert); err != nil {
+		t.Errorf("Expected a host certificate signed by the CA to be accepted but got %s", err)
+	}
+
+	other := *cert
+	other.ValidPrincipals = []string{"10.0.0.3"}
+	if err := other.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHostKey(t, k, alias, &other); err == nil {
+		t.Errorf("Expected a host certificate for another address to be refused")
+	}
+
+	// The CA of a district doesn't vouch for the same IP in another one
+	callback, err := k.Callback("staging", HostKeyAlias("staging", "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := callback("10.0.0.1:22", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}, cert); err == nil {
+		t.Errorf("Expected a host certificate of another district to be refused")
+	}
+
+	forged := *cert
+	if err := forged.SignCert(rand.Reader, newTestSigner(t)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkHostKey(t, k, alias, &forged); err == nil {
+		t.Errorf("Expected a host certificate signed by another CA to be refused")
+	}
+
+	// Hosts of a district with a CA are never pinned
+	if err := checkHostKey(t, k, HostKeyAlias("default", "10.0.0.2"), newTestSigner(t).PublicKey()); err == nil {
+		t.Errorf("Expected a plain host key to be refused")
+	}
+	if b, _ := ioutil.ReadFile(k.Path); strings.Contains(string(b), "10.0.0.2") {
+		t.Errorf("Expected no pinned key in\n%s", b)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(k.Path), "known_hosts.lock")); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released")
+	}
+}
+
+func TestKnownHostsSshOptions(t *testing.T) {
+	k, _ := newTestKnownHosts(t, false)
+	alias := HostKeyAlias("default", "10.0.0.1")
+
+	if !strings.Contains(strings.Join(k.sshOptions("default", alias), " "), "-oStrictHostKeyChecking=accept-new") {
+		t.Errorf("Expected new hosts to be pinned without a host CA")
+	}
+
+	if err := k.TrustAuthority("default", string(ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey()))); err != nil {
+		t.Fatal(err)
+	}
+	options := strings.Join(k.sshOptions("default", alias), " ")
+	if !strings.Contains(options, "-oStrictHostKeyChecking=yes") {
+		t.Errorf("Expected strict checking with a host CA")
+	}
+	// ssh would check the certificate's principals against the alias
+	if strings.Contains(options, "HostKeyAlias") || !strings.Contains(options, "-oUserKnownHostsFile="+k.Path+".default.ca ") {
+		t.Errorf("Expected hosts to be checked by address against the district's CA but got %s", options)
+	}
+}
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	sshPort           = "22"
+	bastionUser       = "hopper"
+	instanceUser      = "ec2-user"
+	sshDialTimeout    = 30 * time.Second
+	sshAliveInterval  = 60 * time.Second
+	sshAliveCountMax  = 720 // 12 hours
+	defaultTermWidth  = 80
+	defaultTermHeight = 24
+	defaultTermType   = "xterm"
+)
+
+// nativeSshCommand connects with golang.org/x/crypto/ssh instead of the
+// ssh binary. It jumps through the bastion the same way ProxyCommand does
+type nativeSshCommand struct {
+	IP          string
+	Certificate *DistrictCertificate
+	Config      SshConfig
+	Options     SshOptions
+}
+
+// Builds a signer that presents the certificate Barcelona signed for
+// our public key
+func certSigner(privateKeyPath string, certificate string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", privateKeyPath, err)
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %s", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("invalid certificate: not an SSH certificate")
+	}
+
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// Returns when a certificate expires, or the zero time for one that
+// never does
+func CertificateValidBefore(certificate string) (time.Time, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid certificate: %s", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid certificate: not an SSH certificate")
+	}
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(cert.ValidBefore), 0), nil
+}
+
+// Plain host key algorithms, for districts without a host CA
+var plainHostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSASHA256,
+	ssh.KeyAlgoRSA,
+}
+
+// The host is verified under alias in knownHosts like the ssh binary
+// does with HostKeyAlias, or by its address when it presents a host
+// certificate
+func sshClientConfig(user string, signer ssh.Signer, knownHosts *KnownHosts, district string, alias string) (*ssh.ClientConfig, error) {
+	callback, err := knownHosts.Callback(district, alias)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: callback,
+		Timeout:         sshDialTimeout,
+	}
+	// Hosts with a host certificate would present it and fail when we
+	// can't check it. Their plain key is pinned instead
+	if !knownHosts.hasAuthority(district) {
+		config.HostKeyAlgorithms = plainHostKeyAlgorithms
+	}
+	return config, nil
+}
+
+func dialBastion(cert *DistrictCertificate, signer ssh.Signer, knownHosts *KnownHosts) (*ssh.Client, error) {
+	config, err := sshClientConfig(bastionUser, signer, knownHosts, cert.District, BastionHostKeyAlias(cert.District))
+	if err != nil {
+		return nil, err
+	}
+	bastion, err := ssh.Dial("tcp", net.JoinHostPort(cert.BastionIP, sshPort), config)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to bastion %s: %s", cert.BastionIP, err)
+	}
+	return bastion, nil
+}
+
+// Opens a connection to the instance through the bastion. Closing the
+// returned client also closes the bastion connection
+func (s *nativeSshCommand) dial(signer ssh.Signer, knownHosts *KnownHosts) (*ssh.Client, error) {
+	config, err := sshClientConfig(instanceUser, signer, knownHosts, s.Certificate.District, HostKeyAlias(s.Certificate.District, s.IP))
+	if err != nil {
+		return nil, err
+	}
+
+	bastion, err := dialBastion(s.Certificate, signer, knownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(s.IP, sshPort)
+	conn, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		bastion.Close()
+		return nil, fmt.Errorf("could not reach %s through bastion: %s", s.IP, err)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		bastion.Close()
+		return nil, fmt.Errorf("could not connect to %s: %s", s.IP, err)
+	}
+
+	client := ssh.NewClient(c, chans, reqs)
+	go func() {
+		client.Wait()
+		bastion.Close()
+	}()
+	return client, nil
+}
+
+// The part of *ssh.Client keepAlive needs
+type keepAliveClient interface {
+	SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error)
+	Close() error
+}
+
+// Sends keepalives like ServerAliveInterval/ServerAliveCountMax and
+// closes the connection when the server stops answering. A request
+// still unanswered at the next tick counts as missed, since SendRequest
+// blocks for as long as the server stays silent
+func keepAlive(client keepAliveClient, interval time.Duration, countMax int, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	missed := 0
+	var reply chan error
+	for {
+		select {
+		case <-done:
+			return
+		case err := <-reply:
+			reply = nil
+			if err != nil {
+				missed++
+			} else {
+				missed = 0
+			}
+		case <-ticker.C:
+			if reply != nil {
+				missed++
+				break
+			}
+			// Buffered so the request can finish after we have returned
+			reply = make(chan error, 1)
+			go func(reply chan<- error) {
+				_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+				reply <- err
+			}(reply)
+		}
+		if missed >= countMax {
+			client.Close()
+			return
+		}
+	}
+}
+
+func (s *nativeSshCommand) Run(command string) error {
+	if s.Config.IsDebug() {
+		fmt.Printf("ssh (native) %s@%s via %s@%s: %s\n", instanceUser, s.IP, bastionUser, s.Certificate.BastionIP, command)
+	}
+
+	signer, err := certSigner(s.Config.GetPrivateKeyPath(), s.Certificate.Certificate)
+	if err != nil {
+		return err
+	}
+
+	knownHosts, err := prepareKnownHosts(s.Certificate, s.Config, BastionHostKeyAlias(s.Certificate.District), HostKeyAlias(s.Certificate.District, s.IP))
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial(signer, knownHosts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go keepAlive(client, sshAliveInterval, sshAliveCountMax, done)
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = s.Options.Stdin
+	session.Stdout = s.Options.Stdout
+	session.Stderr = s.Options.Stderr
+
+	if s.Options.TTY {
+		restore, err := requestPty(session)
+		defer restore()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(command) == 0 {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return err
+	}
+
+	return sessionError(session.Wait())
+}
+
+// An *ssh.ExitError carries the remote exit status. Anything else means
+// the session ended without one
+func sessionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ssh.ExitError); ok {
+		return err
+	}
+	return &SessionLostError{Err: err}
+}
+
+// Like ssh -t -t a PTY is always requested in TTY mode. The local
+// terminal is only switched to raw mode when there is one. restore puts
+// it back and is never nil
+func requestPty(session *ssh.Session) (restore func(), err error) {
+	restore = func() {}
+	width, height := defaultTermWidth, defaultTermHeight
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return restore, err
+		}
+		stop := watchWindowSize(int(os.Stdout.Fd()), session)
+		restore = func() {
+			stop()
+			terminal.Restore(fd, state)
+		}
+
+		if w, h, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil {
+			width, height = w, h
+		}
+	}
+
+	termType := os.Getenv("TERM")
+	if len(termType) == 0 {
+		termType = defaultTermType
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	return restore, session.RequestPty(termType, height, width, modes)
+}
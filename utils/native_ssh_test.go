@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type mockNativeSshConfig struct {
+	native bool
+}
+
+func (m mockNativeSshConfig) GetDistrictCertPath(district string) string { return "" }
+func (m mockNativeSshConfig) GetKnownHostsPath() string                  { return "" }
+func (m mockNativeSshConfig) GetPrivateKeyPath() string                  { return "" }
+func (m mockNativeSshConfig) IsDebug() bool                              { return false }
+func (m mockNativeSshConfig) UseNativeSsh() bool                         { return m.native }
+func (m mockNativeSshConfig) AcceptChangedHostKey() bool                 { return false }
+
+// Writes a private key to dir and returns its path with a certificate
+// for it signed by a throwaway CA
+func generateSignedKey(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "id_ecdsa")
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := ssh.NewSignerFromKey(caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"ec2-user", "hopper"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	err = cert.SignCert(rand.Reader, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, string(ssh.MarshalAuthorizedKey(cert))
+}
+
+func TestCertSigner(t *testing.T) {
+	dir := t.TempDir()
+
+	keyPath, certificate := generateSignedKey(t, dir)
+	signer, err := certSigner(keyPath, certificate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, ok := signer.PublicKey().(*ssh.Certificate); !ok {
+		t.Errorf("Expected the signer to present the certificate")
+	}
+}
+
+func TestCertSignerInvalidCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	keyPath, _ := generateSignedKey(t, dir)
+	_, err := certSigner(keyPath, "garbage")
+	if err == nil {
+		t.Errorf("Expected an error but got none")
+	}
+}
+
+func TestNewSshCommandNative(t *testing.T) {
+	cmd := NewSshCommand("10.0.0.1", testDistrictCertificate, mockNativeSshConfig{native: true}, nil)
+	if _, ok := cmd.(*nativeSshCommand); !ok {
+		t.Errorf("Expected the native implementation but got %T", cmd)
+	}
+
+	cmd = NewSshCommand("10.0.0.1", testDistrictCertificate, mockNativeSshConfig{native: false}, &CommandRunner{})
+	if _, ok := cmd.(*sshCommand); !ok {
+		t.Errorf("Expected the ssh binary implementation but got %T", cmd)
+	}
+}
+
+type silentServerClient struct {
+	block  chan struct{}
+	closed chan struct{}
+}
+
+func (c *silentServerClient) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	<-c.block
+	return false, nil, nil
+}
+
+func (c *silentServerClient) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestKeepAliveClosesSilentConnection(t *testing.T) {
+	client := &silentServerClient{block: make(chan struct{}), closed: make(chan struct{})}
+	defer close(client.block)
+
+	done := make(chan struct{})
+	defer close(done)
+	go keepAlive(client, time.Millisecond, 3, done)
+
+	select {
+	case <-client.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the connection to be closed after the missed keepalives")
+	}
+}
+
+type answeringClient struct {
+	requests chan struct{}
+}
+
+func (c *answeringClient) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	c.requests <- struct{}{}
+	return true, nil, nil
+}
+
+func (c *answeringClient) Close() error {
+	panic("an answering connection must not be closed")
+}
+
+func TestKeepAliveAnsweringConnection(t *testing.T) {
+	client := &answeringClient{requests: make(chan struct{}, 100)}
+	done := make(chan struct{})
+	go keepAlive(client, time.Millisecond, 1000, done)
+
+	for i := 0; i < 10; i++ {
+		<-client.requests
+	}
+	close(done)
+}
+
+func TestSessionError(t *testing.T) {
+	if sessionError(nil) != nil {
+		t.Errorf("Expected no error")
+	}
+
+	exitErr := &ssh.ExitError{}
+	if sessionError(exitErr) != exitErr {
+		t.Errorf("Expected the exit status to be passed on")
+	}
+
+	if _, ok := sessionError(&ssh.ExitMissingError{}).(*SessionLostError); !ok {
+		t.Errorf("Expected a missing exit status to be a lost session")
+	}
+	if _, ok := sessionError(errors.New("EOF")).(*SessionLostError); !ok {
+		t.Errorf("Expected a dropped connection to be a lost session")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Forwards terminal resizes to the remote PTY until stop is called
+func watchWindowSize(fd int, session *ssh.Session) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigs:
+				if w, h, err := terminal.GetSize(fd); err == nil {
+					session.WindowChange(h, w)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
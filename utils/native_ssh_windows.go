@@ -0,0 +1,41 @@
+//go:build windows
+
+package utils
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Windows has no SIGWINCH so the console size is polled instead
+const windowSizePollInterval = 500 * time.Millisecond
+
+// Forwards terminal resizes to the remote PTY until stop is called
+func watchWindowSize(fd int, session *ssh.Session) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(windowSizePollInterval)
+		defer ticker.Stop()
+
+		lastW, lastH, _ := terminal.GetSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w, h, err := terminal.GetSize(fd)
+				if err != nil || (w == lastW && h == lastH) {
+					continue
+				}
+				lastW, lastH = w, h
+				session.WindowChange(h, w)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes every line it receives to the underlying writer
+// with a prefix. Lines from PrefixWriters sharing a lock never interleave,
+// and a PrefixWriter may be written to from several goroutines
+type PrefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	lock   *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func NewPrefixWriter(out io.Writer, prefix string, lock *sync.Mutex) *PrefixWriter {
+	return &PrefixWriter{
+		out:    out,
+		prefix: []byte(prefix),
+		lock:   lock,
+	}
+}
+
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf.Next(i + 1)
+		if err := w.writeLine(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes out a trailing line that has no newline yet
+func (w *PrefixWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := append(w.buf.Bytes(), '\n')
+	w.buf.Reset()
+	return w.writeLine(line)
+}
+
+// Must be called with the lock held
+func (w *PrefixWriter) writeLine(line []byte) error {
+	_, err := w.out.Write(append(append([]byte{}, w.prefix...), line...))
+	return err
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var lock sync.Mutex
+	w := NewPrefixWriter(&out, "[web] ", &lock)
+
+	fmt.Fprint(w, "hello\nwor")
+	fmt.Fprint(w, "ld\npartial")
+
+	if out.String() != "[web] hello\n[web] world\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	w.Flush()
+	if out.String() != "[web] hello\n[web] world\n[web] partial\n" {
+		t.Errorf("Unexpected output after flush: %q", out.String())
+	}
+}
+
+func TestPrefixWriterConcurrentWrites(t *testing.T) {
+	var out bytes.Buffer
+	var lock sync.Mutex
+	stdout := NewPrefixWriter(&out, "[web] ", &lock)
+	stderr := NewPrefixWriter(&out, "[web] ", &lock)
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, w := range []*PrefixWriter{stdout, stdout, stderr} {
+		wg.Add(1)
+		go func(w *PrefixWriter) {
+			defer wg.Done()
+			<-start
+			for i := 0; i < 1000; i++ {
+				fmt.Fprint(w, "line done\n")
+				runtime.Gosched()
+			}
+		}(w)
+	}
+	close(start)
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3000 {
+		t.Fatalf("Expected 3000 lines but got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line != "[web] line done" {
+			t.Fatalf("Unexpected line %q", line)
+		}
+	}
+}
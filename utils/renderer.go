@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// Renderer writes a command's result either as human readable text or
+// as JSON/YAML. Machine readable output always uses the JSON field names
+// so both formats have the same keys
+type Renderer struct {
+	format string
+	out    io.Writer
+}
+
+func NewRenderer(format string, out io.Writer) *Renderer {
+	if len(format) == 0 {
+		format = OutputTable
+	}
+	return &Renderer{
+		format: format,
+		out:    out,
+	}
+}
+
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case OutputTable, OutputJSON, OutputYAML:
+		return nil
+	}
+	return fmt.Errorf("output format must be one of %s, %s or %s", OutputTable, OutputJSON, OutputYAML)
+}
+
+// Returns true when the result is written as JSON or YAML
+func (r *Renderer) IsStructured() bool {
+	return r.format == OutputJSON || r.format == OutputYAML
+}
+
+// Render writes v in the structured formats and calls human otherwise
+func (r *Renderer) Render(v interface{}, human func(w io.Writer)) error {
+	switch r.format {
+	case OutputJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(r.out, string(b))
+		return err
+	case OutputYAML:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		// Going through JSON keeps the field names and their order
+		var node yaml.Node
+		err = yaml.Unmarshal(b, &node)
+		if err != nil {
+			return err
+		}
+		resetYAMLStyle(&node)
+
+		enc := yaml.NewEncoder(r.out)
+		enc.SetIndent(2)
+		err = enc.Encode(&node)
+		if err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	human(r.out)
+	return nil
+}
+
+// Nodes decoded from JSON are in flow style with quoted strings.
+// Resetting the style lets the encoder write plain block YAML
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetYAMLStyle(n)
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+type renderedItem struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func printRenderedItem(w io.Writer) {
+	fmt.Fprintln(w, "Name: web")
+}
+
+func ExampleRenderer_Render_table() {
+	r := NewRenderer(OutputTable, os.Stdout)
+	r.Render(&renderedItem{Name: "web", Count: 2}, printRenderedItem)
+
+	// Output:
+	// Name: web
+}
+
+func ExampleRenderer_Render_json() {
+	r := NewRenderer(OutputJSON, os.Stdout)
+	r.Render(&renderedItem{Name: "web", Count: 2, Tags: []string{"a"}}, printRenderedItem)
+
+	// Output:
+	// {
+	//   "name": "web",
+	//   "count": 2,
+	//   "tags": [
+	//     "a"
+	//   ]
+	// }
+}
+
+func ExampleRenderer_Render_yaml() {
+	r := NewRenderer(OutputYAML, os.Stdout)
+	r.Render(&renderedItem{Name: "web", Count: 2, Tags: []string{"a"}}, printRenderedItem)
+
+	// Output:
+	// name: web
+	// count: 2
+	// tags:
+	//   - a
+}
+
+func ExampleRenderer_Render_yaml_strings() {
+	r := NewRenderer(OutputYAML, os.Stdout)
+	r.Render(map[string]string{"a": "123", "b": "true", "c": ""}, printRenderedItem)
+
+	// Output:
+	// a: "123"
+	// b: "true"
+	// c: ""
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{"table", "json", "yaml"} {
+		if err := ValidateOutputFormat(format); err != nil {
+			t.Errorf("Unexpected error for %s: %s", format, err)
+		}
+	}
+	if err := ValidateOutputFormat("xml"); err == nil {
+		t.Errorf("Expected an error for xml")
+	}
+}
@@ -0,0 +1,339 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed scheduled task expression. Barcelona passes these
+// to CloudWatch Events, so both rate(...) and the six field cron(...)
+// syntax are supported
+type Schedule struct {
+	Expression string
+
+	// Set for rate(...) expressions
+	RateValue int
+	RateUnit  string
+
+	// Set for cron(...) expressions
+	minutes []bool
+	hours   []bool
+	months  []bool
+	years   []bool
+	dom     dayOfMonthField
+	dow     dayOfWeekField
+}
+
+type dayOfMonthField struct {
+	any     bool
+	days    []bool
+	last    bool
+	weekday int // nearest weekday to this day (nW)
+	lastW   bool
+}
+
+type dayOfWeekField struct {
+	any   bool
+	days  []bool
+	last  int // last given weekday of the month (nL)
+	nth   int // nth given weekday of the month (d#n)
+	nthOf int
+}
+
+var rateRegexp = regexp.MustCompile(`^rate\(\s*(\d+)\s+([a-z]+)\s*\)$`)
+var cronRegexp = regexp.MustCompile(`^cron\((.*)\)$`)
+
+var monthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var dayNames = map[string]int{
+	"SUN": 1, "MON": 2, "TUE": 3, "WED": 4, "THU": 5, "FRI": 6, "SAT": 7,
+}
+
+func (s *Schedule) IsRate() bool {
+	return len(s.RateUnit) > 0
+}
+
+// Describes a rate(...) expression, e.g. "every 2 hours"
+func (s *Schedule) Interval() string {
+	if s.RateValue == 1 {
+		return "every " + s.RateUnit
+	}
+	return fmt.Sprintf("every %d %ss", s.RateValue, s.RateUnit)
+}
+
+// Next returns the first time after the given one that a cron(...)
+// expression fires, in UTC like CloudWatch Events. A rate(...) expression
+// counts from when the rule was created, which we don't know, and a cron
+// expression may never fire again. Both return the zero time
+func (s *Schedule) Next(after time.Time) time.Time {
+	if s.IsRate() {
+		return time.Time{}
+	}
+
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	for day.Year() < len(s.years) {
+		if !s.years[day.Year()] {
+			day = time.Date(day.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.months[int(day.Month())] {
+			day = time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+
+		if s.matchesDay(day) {
+			from := 0
+			if day.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)) {
+				from = t.Hour()*60 + t.Minute()
+			}
+			for m := from; m < 24*60; m++ {
+				if s.hours[m/60] && s.minutes[m%60] {
+					return day.Add(time.Duration(m) * time.Minute)
+				}
+			}
+		}
+
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) matchesDay(day time.Time) bool {
+	lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	d := day.Day()
+
+	if !s.dom.any {
+		switch {
+		case s.dom.last:
+			return d == lastDay
+		case s.dom.lastW:
+			return d == nearestWeekday(day, lastDay, lastDay)
+		case s.dom.weekday > 0:
+			return s.dom.weekday <= lastDay && d == nearestWeekday(day, s.dom.weekday, lastDay)
+		}
+		return s.dom.days[d]
+	}
+
+	// Cron numbers the days of the week from 1 (SUN)
+	wd := int(day.Weekday()) + 1
+	switch {
+	case s.dow.last > 0:
+		return wd == s.dow.last && d+7 > lastDay
+	case s.dow.nth > 0:
+		return wd == s.dow.nthOf && (d-1)/7+1 == s.dow.nth
+	}
+	return s.dow.days[wd]
+}
+
+// Returns the weekday closest to the nth day of day's month without
+// leaving the month
+func nearestWeekday(day time.Time, n, lastDay int) int {
+	switch time.Date(day.Year(), day.Month(), n, 0, 0, 0, 0, time.UTC).Weekday() {
+	case time.Saturday:
+		if n == 1 {
+			return n + 2
+		}
+		return n - 1
+	case time.Sunday:
+		if n == lastDay {
+			return n - 2
+		}
+		return n + 1
+	}
+	return n
+}
+
+func ParseSchedule(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if m := rateRegexp.FindStringSubmatch(expr); m != nil {
+		return parseRate(expr, m[1], m[2])
+	}
+
+	if m := cronRegexp.FindStringSubmatch(expr); m != nil {
+		return parseCron(expr, m[1])
+	}
+
+	return nil, fmt.Errorf("%q is not a rate(...) or cron(...) expression", expr)
+}
+
+func parseRate(expr, value, unit string) (*Schedule, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("rate value must be a positive integer in %q", expr)
+	}
+
+	singular := strings.TrimSuffix(unit, "s")
+	if singular != "minute" && singular != "hour" && singular != "day" {
+		return nil, fmt.Errorf("rate unit must be minute(s), hour(s) or day(s) in %q", expr)
+	}
+	if n == 1 && unit != singular {
+		return nil, fmt.Errorf("rate unit must be singular when the value is 1 in %q", expr)
+	}
+	if n > 1 && unit == singular {
+		return nil, fmt.Errorf("rate unit must be plural when the value is greater than 1 in %q", expr)
+	}
+
+	return &Schedule{Expression: expr, RateValue: n, RateUnit: singular}, nil
+}
+
+func parseCron(expr, body string) (*Schedule, error) {
+	fields := strings.Fields(body)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("cron expression must have 6 fields (minutes hours day-of-month month day-of-week year) in %q", expr)
+	}
+
+	s := &Schedule{Expression: expr}
+	var err error
+
+	if s.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minutes: %s in %q", err, expr)
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hours: %s in %q", err, expr)
+	}
+	if s.dom, err = parseDayOfMonth(fields[2]); err != nil {
+		return nil, fmt.Errorf("day-of-month: %s in %q", err, expr)
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %s in %q", err, expr)
+	}
+	if s.dow, err = parseDayOfWeek(fields[4]); err != nil {
+		return nil, fmt.Errorf("day-of-week: %s in %q", err, expr)
+	}
+	if s.years, err = parseCronField(fields[5], 1970, 2199, nil); err != nil {
+		return nil, fmt.Errorf("year: %s in %q", err, expr)
+	}
+
+	if s.dom.any == s.dow.any {
+		return nil, fmt.Errorf("exactly one of day-of-month and day-of-week must be ? in %q", expr)
+	}
+
+	return s, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return n, nil
+}
+
+// Parses a comma separated list of *, values, ranges and increments
+// into a set indexed by value
+func parseCronField(field string, min, max int, names map[string]int) ([]bool, error) {
+	set := make([]bool, max+1)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid increment %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		from, to := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = parseCronValue(bounds[0], names); err != nil {
+				return nil, err
+			}
+			if to, err = parseCronValue(bounds[1], names); err != nil {
+				return nil, err
+			}
+		default:
+			v, err := parseCronValue(part, names)
+			if err != nil {
+				return nil, err
+			}
+			from = v
+			if step == 1 {
+				to = v
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+func parseDayOfMonth(field string) (dayOfMonthField, error) {
+	switch {
+	case field == "?":
+		return dayOfMonthField{any: true}, nil
+	case field == "L":
+		return dayOfMonthField{last: true}, nil
+	case field == "LW":
+		return dayOfMonthField{lastW: true}, nil
+	case strings.HasSuffix(field, "W"):
+		n, err := strconv.Atoi(strings.TrimSuffix(field, "W"))
+		if err != nil || n < 1 || n > 31 {
+			return dayOfMonthField{}, fmt.Errorf("invalid weekday %q", field)
+		}
+		return dayOfMonthField{weekday: n}, nil
+	}
+
+	days, err := parseCronField(field, 1, 31, nil)
+	if err != nil {
+		return dayOfMonthField{}, err
+	}
+	return dayOfMonthField{days: days}, nil
+}
+
+func parseDayOfWeek(field string) (dayOfWeekField, error) {
+	switch {
+	case field == "?":
+		return dayOfWeekField{any: true}, nil
+	case strings.Contains(field, "#"):
+		parts := strings.SplitN(field, "#", 2)
+		d, err := parseCronValue(parts[0], dayNames)
+		if err != nil || d < 1 || d > 7 {
+			return dayOfWeekField{}, fmt.Errorf("invalid day %q", field)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 || n > 5 {
+			return dayOfWeekField{}, fmt.Errorf("invalid occurrence %q", field)
+		}
+		return dayOfWeekField{nth: n, nthOf: d}, nil
+	case field == "L":
+		return dayOfWeekField{last: 7}, nil
+	case strings.HasSuffix(field, "L"):
+		d, err := parseCronValue(strings.TrimSuffix(field, "L"), dayNames)
+		if err != nil || d < 1 || d > 7 {
+			return dayOfWeekField{}, fmt.Errorf("invalid day %q", field)
+		}
+		return dayOfWeekField{last: d}, nil
+	}
+
+	days, err := parseCronField(field, 1, 7, dayNames)
+	if err != nil {
+		return dayOfWeekField{}, err
+	}
+	return dayOfWeekField{days: days}, nil
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	after := time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)
+
+	cases := map[string]string{
+		"cron(0 12 * * ? *)":          "2024-01-31T12:00:00Z",
+		"cron(30 10 * * ? *)":         "2024-02-01T10:30:00Z",
+		"cron(0/15 * * * ? *)":        "2024-01-31T10:45:00Z",
+		"cron(0 9 ? * MON-FRI *)":     "2024-02-01T09:00:00Z",
+		"cron(0 0 L * ? *)":           "2024-02-29T00:00:00Z",
+		"cron(0 0 LW * ? *)":          "2024-02-29T00:00:00Z",
+		"cron(0 0 3W * ? *)":          "2024-02-02T00:00:00Z",
+		"cron(0 0 ? * 6L *)":          "2024-02-23T00:00:00Z",
+		"cron(0 0 ? * 2#1 *)":         "2024-02-05T00:00:00Z",
+		"cron(0 8 1 JAN ? 2025)":      "2025-01-01T08:00:00Z",
+		"cron(0 8 1 JAN ? 2020-2023)": "0001-01-01T00:00:00Z",
+		"rate(1 hour)":                "0001-01-01T00:00:00Z",
+	}
+
+	for expr, expected := range cases {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", expr, err)
+		}
+		if next := s.Next(after).Format(time.RFC3339); next != expected {
+			t.Errorf("%s: expected %s but got %s", expr, expected, next)
+		}
+	}
+}
+
+func TestScheduleNextInUTC(t *testing.T) {
+	s, err := ParseSchedule("cron(0 12 * * ? *)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	next := s.Next(time.Date(2024, 1, 1, 20, 0, 0, 0, tokyo))
+	if expected := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC); !next.Equal(expected) {
+		t.Errorf("Expected %s but got %s", expected, next)
+	}
+}
+
+func TestScheduleInterval(t *testing.T) {
+	cases := map[string]string{
+		"rate(1 minute)": "every minute",
+		"rate(2 hours)":  "every 2 hours",
+	}
+	for expr, expected := range cases {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", expr, err)
+		}
+		if interval := s.Interval(); interval != expected {
+			t.Errorf("Expected %q but got %q", expected, interval)
+		}
+	}
+}
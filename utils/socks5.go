@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// The parts of RFC 1928 the proxy needs: no authentication and CONNECT
+const (
+	socks5Version          = 5
+	socks5NoAuth           = 0
+	socks5NoAcceptable     = 0xff
+	socks5Connect          = 1
+	socks5AddrIPv4         = 1
+	socks5AddrDomain       = 3
+	socks5AddrIPv6         = 4
+	socks5Succeeded        = 0
+	socks5GeneralFailure   = 1
+	socks5CmdNotSupported  = 7
+	socks5AddrNotSupported = 8
+)
+
+// Reads the greeting and the CONNECT request of a SOCKS5 client and
+// returns the address it asked for. Domain names are passed on as they
+// are so that they resolve inside the VPC
+func socks5Handshake(conn io.ReadWriter) (string, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+
+	method := byte(socks5NoAcceptable)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5NoAcceptable {
+		return "", fmt.Errorf("client does not support connecting without authentication")
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", err
+	}
+	if request[1] != socks5Connect {
+		socks5WriteReply(conn, socks5CmdNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+
+	var host string
+	switch request[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		size := net.IPv4len
+		if request[3] == socks5AddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AddrDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return "", err
+		}
+		name := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		socks5WriteReply(conn, socks5AddrNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", request[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// Tells the client whether the connection it asked for was made
+func socks5Reply(conn io.Writer, dialErr error) error {
+	if dialErr != nil {
+		return socks5WriteReply(conn, socks5GeneralFailure)
+	}
+	return socks5WriteReply(conn, socks5Succeeded)
+}
+
+// The bound address is of no use to clients through a bastion, so it
+// is always 0.0.0.0:0
+func socks5WriteReply(conn io.Writer, status byte) error {
+	_, err := conn.Write([]byte{socks5Version, status, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
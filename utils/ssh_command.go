@@ -2,16 +2,24 @@ package utils
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io"
+	"os"
 	"strings"
 )
 
 type SshConfig interface {
-	GetCertPath() string
+	GetDistrictCertPath(district string) string
+	GetKnownHostsPath() string
 	GetPrivateKeyPath() string
 	IsDebug() bool
+	UseNativeSsh() bool
+	AcceptChangedHostKey() bool
 }
 
+// The ssh binary exits with this when it fails itself rather than
+// passing on the remote command's status
+const SshErrorStatus = 255
+
 type SshCommand interface {
 	Run(command string) error
 }
@@ -20,45 +28,118 @@ type SshCommandRunner interface {
 	RunCommand(name string, arg ...string) error
 }
 
+// Runners that implement this get the streams from SshOptions instead
+// of always using the process' own
+type StreamCommandRunner interface {
+	RunCommandWithStreams(stdin io.Reader, stdout io.Writer, stderr io.Writer, name string, arg ...string) error
+}
+
+// Returned when the connection drops after the remote command started.
+// Unlike a failure to connect the command may still be running
+type SessionLostError struct {
+	Err error
+}
+
+func (e *SessionLostError) Error() string {
+	return "lost the connection: " + e.Err.Error()
+}
+
+type SshOptions struct {
+	// Allocate a PTY on the remote side
+	TTY bool
+	// Forwarded to the remote command. nil sends nothing
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Options for an interactive session on the current terminal
+func DefaultSshOptions() SshOptions {
+	return SshOptions{
+		TTY:    true,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
 type sshCommand struct {
 	IP          string
-	BastionIP   string
-	Certificate string
+	Certificate *DistrictCertificate
 	Config      SshConfig
 	CmdRunner   SshCommandRunner
+	Options     SshOptions
+}
+
+// The certificate comes from a CertCache and is already in its file
+func NewSshCommand(IP string, cert *DistrictCertificate, sshConfig SshConfig, cmdRunner SshCommandRunner) SshCommand {
+	return NewSshCommandWithOptions(IP, cert, sshConfig, cmdRunner, DefaultSshOptions())
 }
 
-func NewSshCommand(IP string, bastionIP string, certificate string, sshConfig SshConfig, cmdRunner SshCommandRunner) SshCommand {
+func NewSshCommandWithOptions(IP string, cert *DistrictCertificate, sshConfig SshConfig, cmdRunner SshCommandRunner, options SshOptions) SshCommand {
+	if sshConfig.UseNativeSsh() {
+		return &nativeSshCommand{
+			IP:          IP,
+			Certificate: cert,
+			Config:      sshConfig,
+			Options:     options,
+		}
+	}
+
 	return &sshCommand{
 		IP:          IP,
-		BastionIP:   bastionIP,
-		Certificate: certificate,
+		Certificate: cert,
 		Config:      sshConfig,
 		CmdRunner:   cmdRunner,
+		Options:     options,
 	}
 }
 
 func (ssh *sshCommand) Run(command string) error {
-	err := ioutil.WriteFile(ssh.Config.GetCertPath(), []byte(ssh.Certificate), 0644)
+	district := ssh.Certificate.District
+	bastionAlias := BastionHostKeyAlias(district)
+	alias := HostKeyAlias(district, ssh.IP)
+	knownHosts, err := prepareKnownHosts(ssh.Certificate, ssh.Config, bastionAlias, alias)
 	if err != nil {
 		return err
 	}
 
-	sshArgs := [...]string{
-		"-t", "-t",
-		"-oStrictHostKeyChecking=no",
-		"-oLogLevel=QUIET",
-		"-oUserKnownHostsFile=/dev/null",
+	var sshArgs []string
+	if ssh.Options.TTY {
+		sshArgs = append(sshArgs, "-t", "-t")
+	} else {
+		sshArgs = append(sshArgs, "-T")
+	}
+	if ssh.Options.Stdin == nil {
+		sshArgs = append(sshArgs, "-n")
+	}
+	sshArgs = append(sshArgs, knownHosts.sshOptions(district, alias)...)
+	sshArgs = append(sshArgs,
+		"-oLogLevel=ERROR",
 		"-oServerAliveInterval=60",
 		"-oServerAliveCountMax=720", // 12 hours
-		fmt.Sprintf("-oProxyCommand=ssh -W %%h:%%p -i %s hopper@%s", ssh.Config.GetPrivateKeyPath(), ssh.BastionIP),
+		fmt.Sprintf("-oProxyCommand=ssh -W %%h:%%p %s -oLogLevel=ERROR -i %s -oCertificateFile=%s hopper@%s", strings.Join(knownHosts.sshOptions(district, bastionAlias), " "), ssh.Config.GetPrivateKeyPath(), ssh.Certificate.Path, ssh.Certificate.BastionIP),
 		"-i", ssh.Config.GetPrivateKeyPath(),
+		"-oCertificateFile="+ssh.Certificate.Path,
 		fmt.Sprintf("ec2-user@%s", ssh.IP),
 		command,
-	}
+	)
 	if ssh.Config.IsDebug() {
-		fmt.Printf("ssh %s\n", strings.Join(sshArgs[:], " "))
+		fmt.Printf("ssh %s\n", strings.Join(sshArgs, " "))
 	}
 
-	return ssh.CmdRunner.RunCommand("ssh", sshArgs[:]...)
+	if runner, ok := ssh.CmdRunner.(StreamCommandRunner); ok {
+		err = runner.RunCommandWithStreams(ssh.Options.Stdin, ssh.Options.Stdout, ssh.Options.Stderr, "ssh", sshArgs...)
+	} else {
+		err = ssh.CmdRunner.RunCommand("ssh", sshArgs...)
+	}
+	if code, ok := ExitCode(err); ok && code == SshErrorStatus {
+		// ssh prints why it failed but doesn't know about our flag
+		stderr := ssh.Options.Stderr
+		if stderr == nil {
+			stderr = os.Stderr
+		}
+		fmt.Fprintln(stderr, "ssh failed. If it refused a changed host key and you are sure the host was replaced, run again with --accept-changed-host-key")
+	}
+	return err
 }
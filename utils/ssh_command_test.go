@@ -1,3 +1,117 @@
 package utils
 
-import ()
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type mockSshConfig struct {
+	knownHostsPath string
+}
+
+func (m mockSshConfig) GetDistrictCertPath(district string) string {
+	return "/keys/certs/" + district + "-cert.pub"
+}
+func (m mockSshConfig) GetKnownHostsPath() string  { return m.knownHostsPath }
+func (m mockSshConfig) GetPrivateKeyPath() string  { return "/keys/id_ecdsa" }
+func (m mockSshConfig) IsDebug() bool              { return false }
+func (m mockSshConfig) UseNativeSsh() bool         { return false }
+func (m mockSshConfig) AcceptChangedHostKey() bool { return false }
+
+type recordingCommandRunner struct {
+	args []string
+}
+
+func (r *recordingCommandRunner) RunCommand(name string, arg ...string) error {
+	r.args = arg
+	return nil
+}
+
+var testDistrictCertificate = &DistrictCertificate{
+	District:  "default",
+	BastionIP: "1.2.3.4",
+	Path:      "/keys/certs/default-cert.pub",
+}
+
+func newMockSshConfig(t *testing.T) mockSshConfig {
+	return mockSshConfig{knownHostsPath: filepath.Join(t.TempDir(), "known_hosts")}
+}
+
+func runSshCommandArgs(t *testing.T, config mockSshConfig, options SshOptions) string {
+	runner := &recordingCommandRunner{}
+	ssh := NewSshCommandWithOptions("10.0.0.1", testDistrictCertificate, config, runner, options)
+	err := ssh.Run("ls")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return strings.Join(runner.args, " ")
+}
+
+func TestSshCommandTTY(t *testing.T) {
+	args := runSshCommandArgs(t, newMockSshConfig(t), DefaultSshOptions())
+	if !strings.HasPrefix(args, "-t -t -o") {
+		t.Errorf("Expected a forced PTY but got %s", args)
+	}
+	if !strings.HasSuffix(args, "ec2-user@10.0.0.1 ls") {
+		t.Errorf("Unexpected arguments %s", args)
+	}
+}
+
+func TestSshCommandDistrictCertificate(t *testing.T) {
+	args := runSshCommandArgs(t, newMockSshConfig(t), DefaultSshOptions())
+	if !strings.Contains(args, " -i /keys/id_ecdsa -oCertificateFile=/keys/certs/default-cert.pub hopper@1.2.3.4") {
+		t.Errorf("Expected the bastion hop to use the district's certificate in %s", args)
+	}
+	if !strings.Contains(args, " -i /keys/id_ecdsa -oCertificateFile=/keys/certs/default-cert.pub ec2-user@10.0.0.1") {
+		t.Errorf("Expected the instance hop to use the district's certificate in %s", args)
+	}
+}
+
+func TestSshCommandHostKeyAlias(t *testing.T) {
+	config := newMockSshConfig(t)
+	args := runSshCommandArgs(t, config, DefaultSshOptions())
+	knownHosts := config.GetKnownHostsPath()
+	if !strings.Contains(args, "-oProxyCommand=ssh -W %h:%p -oHostKeyAlias=bcn-default-bastion -oUserKnownHostsFile="+knownHosts+" -oStrictHostKeyChecking=accept-new ") {
+		t.Errorf("Expected the bastion's key to be checked in bcn's known_hosts in %s", args)
+	}
+	if !strings.Contains(args, "-oHostKeyAlias=bcn-default-10.0.0.1 -oUserKnownHostsFile="+knownHosts+" -oStrictHostKeyChecking=accept-new ") {
+		t.Errorf("Expected the instance's key to be checked in bcn's known_hosts in %s", args)
+	}
+	if strings.Contains(args, "StrictHostKeyChecking=no") {
+		t.Errorf("Unexpected StrictHostKeyChecking=no in %s", args)
+	}
+}
+
+func TestSshCommandNoTTY(t *testing.T) {
+	args := runSshCommandArgs(t, newMockSshConfig(t), SshOptions{Stdout: os.Stdout, Stderr: os.Stderr})
+	if !strings.HasPrefix(args, "-T -n -o") {
+		t.Errorf("Expected no PTY and no stdin but got %s", args)
+	}
+
+	args = runSshCommandArgs(t, newMockSshConfig(t), SshOptions{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr})
+	if !strings.HasPrefix(args, "-T -o") {
+		t.Errorf("Expected no PTY with stdin but got %s", args)
+	}
+}
+
+type failingCommandRunner struct{}
+
+func (r failingCommandRunner) RunCommand(name string, arg ...string) error {
+	return exec.Command("sh", "-c", "exit 255").Run()
+}
+
+func TestSshCommandFailureMentionsOverride(t *testing.T) {
+	var stderr bytes.Buffer
+	ssh := NewSshCommandWithOptions("10.0.0.1", testDistrictCertificate, newMockSshConfig(t), failingCommandRunner{}, SshOptions{Stderr: &stderr})
+	err := ssh.Run("ls")
+	if code, ok := ExitCode(err); !ok || code != 255 {
+		t.Fatalf("Expected ssh's exit status to be passed on but got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "--accept-changed-host-key") {
+		t.Errorf("Expected the override to be mentioned in %s", stderr.String())
+	}
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Checksums of copied regular files keyed by their path relative to the
+// copied file or directory. A copied file itself is keyed by ""
+type CopyChecksums map[string]string
+
+// Key of a tar or find path, whose first element is the copied file or
+// directory
+func checksumKey(name string) string {
+	name = strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "./")
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// ParseSha256sum reads the output of sha256sum run on the copied file or
+// directory
+func ParseSha256sum(output string) CopyChecksums {
+	sums := CopyChecksums{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[checksumKey(fields[1])] = fields[0]
+	}
+	return sums
+}
+
+// Compare returns the files whose checksums differ or that are missing
+// on one side
+func (c CopyChecksums) Compare(other CopyChecksums) []string {
+	var mismatched []string
+	for name, sum := range c {
+		if other[name] != sum {
+			mismatched = append(mismatched, name)
+		}
+	}
+	for name := range other {
+		if _, ok := c[name]; !ok {
+			mismatched = append(mismatched, name)
+		}
+	}
+	return mismatched
+}
+
+// WriteTar writes the file or directory at src to w with its base name
+// as the top entry. Symlinks are skipped and reported to warn
+func WriteTar(w io.Writer, src string, warn io.Writer) (CopyChecksums, error) {
+	tw := tar.NewWriter(w)
+	sums := CopyChecksums{}
+	root := filepath.Dir(filepath.Clean(src))
+
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			fmt.Fprintf(warn, "Skipped the symlink %s\n", p)
+			return nil
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			fmt.Fprintf(warn, "Skipped %s since it is not a regular file\n", p)
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		// A sub-second mtime makes tar warn about timestamps in the
+		// future right after a file was written
+		header.ModTime = info.ModTime().Truncate(time.Second)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(tw, h), f)
+		if err != nil {
+			return err
+		}
+		sums[checksumKey(name)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, tw.Close()
+}
+
+// ExtractTar writes the entries read from r under dst. The top entry
+// becomes dst itself, or goes inside it when dst is an existing
+// directory. Entries that would end up outside dst are refused
+func ExtractTar(r io.Reader, dst string, warn io.Writer) (CopyChecksums, error) {
+	tr := tar.NewReader(r)
+	sums := CopyChecksums{}
+	intoDir := false
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		intoDir = true
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(header.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("refusing to extract %s", header.Name)
+		}
+		key := checksumKey(name)
+		target := dst
+		if intoDir {
+			target = filepath.Join(dst, filepath.FromSlash(name))
+		} else if len(key) > 0 {
+			target = filepath.Join(dst, filepath.FromSlash(key))
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			var sum string
+			sum, err = extractFile(tr, target, os.FileMode(header.Mode).Perm())
+			sums[key] = sum
+		default:
+			fmt.Fprintf(warn, "Skipped %s since it is not a regular file or directory\n", header.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sums, nil
+}
+
+func extractFile(r io.Reader, target string, perm os.FileMode) (string, error) {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), f.Close()
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "dumps")
+	os.MkdirAll(filepath.Join(src, "old"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "heap.hprof"), []byte("heap"), 0600)
+	ioutil.WriteFile(filepath.Join(src, "old", "heap.hprof"), []byte("older heap"), 0644)
+
+	var archive bytes.Buffer
+	written, err := WriteTar(&archive, src, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(written) != 2 || len(written["old/heap.hprof"]) != 64 {
+		t.Fatalf("Unexpected checksums %v", written)
+	}
+
+	// Into a new directory and into an existing one
+	for _, c := range []struct{ dst, file string }{
+		{filepath.Join(dir, "copy"), filepath.Join(dir, "copy", "old", "heap.hprof")},
+		{dir, filepath.Join(dir, "dumps", "old", "heap.hprof")},
+	} {
+		extracted, err := ExtractTar(bytes.NewReader(archive.Bytes()), c.dst, ioutil.Discard)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if mismatched := written.Compare(extracted); len(mismatched) > 0 {
+			t.Errorf("Checksums don't match for %v", mismatched)
+		}
+		if b, err := ioutil.ReadFile(c.file); err != nil || string(b) != "older heap" {
+			t.Errorf("Expected %s to be extracted: %v", c.file, err)
+		}
+	}
+}
+
+func TestExtractTarRefusesEscapingEntries(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("evil"))
+	tw.Close()
+
+	dir := t.TempDir()
+
+	if _, err := ExtractTar(&archive, filepath.Join(dir, "dst"), ioutil.Discard); err == nil {
+		t.Errorf("Expected an entry outside the destination to be refused")
+	}
+}
+
+func TestParseSha256sum(t *testing.T) {
+	sums := ParseSha256sum("aaa  dumps/heap.hprof\nbbb  ./dumps/old/heap.hprof\nsha256sum: x: Permission denied\n")
+	expected := CopyChecksums{"heap.hprof": "aaa", "old/heap.hprof": "bbb"}
+	if mismatched := expected.Compare(sums); len(mismatched) > 0 {
+		t.Errorf("Expected %v but got %v", expected, sums)
+	}
+
+	file := ParseSha256sum("ccc  heap.hprof\n")
+	if file[""] != "ccc" {
+		t.Errorf("Expected a single file to be keyed by \"\" but got %v", file)
+	}
+}
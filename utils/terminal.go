@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func IsTerminal(f *os.File) bool {
+	return terminal.IsTerminal(int(f.Fd()))
+}
+
+// Returns true when f is a pipe or a redirected file rather than a
+// terminal or nothing at all
+func IsPiped(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Tunnel forwards every connection accepted on a local listener to a
+// remote address through a BastionDialer. Without a Remote it is a
+// SOCKS5 proxy and each client picks its own destination
+type Tunnel struct {
+	Remote string
+	Dialer BastionDialer
+	// Connection counts are reported here as they change
+	Out io.Writer
+	// Also report the destination of every connection
+	Debug bool
+
+	lock   sync.Mutex
+	conns  map[net.Conn]bool
+	active int
+	total  int
+	closed bool
+}
+
+// Serve accepts connections until ctx is done, then closes the ones
+// still open and returns once they have finished
+func (t *Tunnel) Serve(ctx context.Context, listener net.Listener) error {
+	t.lock.Lock()
+	t.conns = map[net.Conn]bool{}
+	t.lock.Unlock()
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	var err error
+	for {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			if ctx.Err() == nil {
+				err = acceptErr
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.forward(conn)
+		}()
+	}
+	close(stop)
+
+	t.closeAll()
+	wg.Wait()
+	return err
+}
+
+func (t *Tunnel) forward(local net.Conn) {
+	if !t.track(local) {
+		return
+	}
+	t.lock.Lock()
+	t.active++
+	t.total++
+	t.report("%s connected", local.RemoteAddr())
+	t.lock.Unlock()
+
+	defer func() {
+		t.untrack(local)
+		t.lock.Lock()
+		t.active--
+		t.report("%s closed", local.RemoteAddr())
+		t.lock.Unlock()
+	}()
+
+	addr := t.Remote
+	socks := len(addr) == 0
+	if socks {
+		var err error
+		addr, err = socks5Handshake(local)
+		if err != nil {
+			t.log("%s: %s", local.RemoteAddr(), err)
+			return
+		}
+	}
+	if t.Debug {
+		t.log("%s -> %s", local.RemoteAddr(), addr)
+	}
+
+	remote, err := t.Dialer.Dial(addr)
+	if socks {
+		socks5Reply(local, err)
+	}
+	if err != nil {
+		t.log("could not reach %s: %s", addr, err)
+		return
+	}
+	if !t.track(remote) {
+		return
+	}
+	defer t.untrack(remote)
+
+	// A side that is done sending only closes its direction so that it
+	// still gets the reply. Both are closed once both directions are done
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(remote, local)
+		closeWrite(remote)
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(local, remote)
+		closeWrite(local)
+	}()
+	wg.Wait()
+}
+
+// Implemented by connections that can be half closed like *net.TCPConn
+// and the connections of an ssh client
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Tells the other end of conn that nothing more will be sent. A conn that
+// can't be half closed is closed
+func closeWrite(conn net.Conn) error {
+	if c, ok := conn.(closeWriter); ok {
+		return c.CloseWrite()
+	}
+	return conn.Close()
+}
+
+func (t *Tunnel) log(format string, args ...interface{}) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	fmt.Fprintf(t.Out, format+"\n", args...)
+}
+
+// Must be called with the lock held
+func (t *Tunnel) report(format string, args ...interface{}) {
+	fmt.Fprintf(t.Out, format+" (%d active, %d total)\n", append(args, t.active, t.total)...)
+}
+
+// Registers conn so that closeAll can close it. A conn that arrives
+// after closeAll is closed right away and false is returned
+func (t *Tunnel) track(conn net.Conn) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		conn.Close()
+		return false
+	}
+	t.conns[conn] = true
+	return true
+}
+
+func (t *Tunnel) untrack(conn net.Conn) {
+	t.lock.Lock()
+	delete(t.conns, conn)
+	t.lock.Unlock()
+	conn.Close()
+}
+
+func (t *Tunnel) closeAll() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Dials straight to the address instead of going through a bastion
+type directDialer struct{}
+
+func (d directDialer) Dial(addr string) (net.Conn, error) { return net.Dial("tcp", addr) }
+func (d directDialer) Close() error                       { return nil }
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func startEchoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestTunnel(t *testing.T) {
+	echo := startEchoServer(t)
+	defer echo.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &syncBuffer{}
+	tunnel := &Tunnel{Remote: echo.Addr().String(), Dialer: directDialer{}, Out: out}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- tunnel.Serve(ctx, listener)
+	}()
+
+	// Two connections open at the same time
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i, conn := range conns {
+		msg := fmt.Sprintf("hello %d\n", i)
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply != msg {
+			t.Errorf("Expected %q but got %q", msg, reply)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+
+	// Open connections are closed on shutdown
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Errorf("Expected the connection to be closed")
+		}
+	}
+
+	log := out.String()
+	if !strings.Contains(log, "(2 active, 2 total)") {
+		t.Errorf("Expected two active connections in %q", log)
+	}
+	if !strings.Contains(log, "(0 active, 2 total)") {
+		t.Errorf("Expected no active connections at the end in %q", log)
+	}
+}
+
+func TestTunnelHalfClose(t *testing.T) {
+	// Replies with the size of the request once the client is done sending
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go func() {
+		conn, err := server.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		fmt.Fprintf(conn, "got %d bytes", len(b))
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tunnel := &Tunnel{Remote: server.Addr().String(), Dialer: directDialer{}, Out: &syncBuffer{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tunnel.Serve(ctx, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "got 5 bytes" {
+		t.Errorf("Expected the reply after closing for writing but got %q", reply)
+	}
+}
+
+func TestTunnelSocks5(t *testing.T) {
+	echo := startEchoServer(t)
+	defer echo.Close()
+	_, port, _ := net.SplitHostPort(echo.Addr().String())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &syncBuffer{}
+	tunnel := &Tunnel{Dialer: directDialer{}, Out: out, Debug: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tunnel.Serve(ctx, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// No authentication, then CONNECT to a domain name
+	conn.Write([]byte{5, 1, 0})
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil || !bytes.Equal(reply, []byte{5, 0}) {
+		t.Fatalf("Unexpected greeting reply %v: %v", reply, err)
+	}
+
+	p, _ := strconv.Atoi(port)
+	host := "127.0.0.1"
+	request := append([]byte{5, 1, 0, 3, byte(len(host))}, host...)
+	request = append(request, byte(p>>8), byte(p))
+	conn.Write(request)
+	reply = make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != 0 {
+		t.Fatalf("Unexpected connect reply %v: %v", reply, err)
+	}
+
+	conn.Write([]byte("hello\n"))
+	echoed, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || echoed != "hello\n" {
+		t.Errorf("Unexpected reply %q: %v", echoed, err)
+	}
+
+	if log := out.String(); !strings.Contains(log, "-> 127.0.0.1:"+port) {
+		t.Errorf("Expected the destination to be logged in %q", log)
+	}
+}
+
+func TestSocks5HandshakeRejectsAuthentication(t *testing.T) {
+	conn := &fakeReadWriter{in: bytes.NewReader([]byte{5, 1, 2})}
+	if _, err := socks5Handshake(conn); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if !bytes.Equal(conn.out.Bytes(), []byte{5, 0xff}) {
+		t.Errorf("Unexpected reply %v", conn.out.Bytes())
+	}
+}
+
+type fakeReadWriter struct {
+	in  io.Reader
+	out bytes.Buffer
+}
+
+func (f *fakeReadWriter) Read(p []byte) (int, error)  { return f.in.Read(p) }
+func (f *fakeReadWriter) Write(p []byte) (int, error) { return f.out.Write(p) }